@@ -100,7 +100,7 @@ func (aof *AOF) Close() error {
 	return nil
 }
 
-func (aof *AOF) readValues(iterator func(v Value)) error {
+func (aof *AOF) readValues(iterator func(v Value) bool) error {
 	aof.atEnd = false
 	if _, err := aof.f.Seek(0, 0); err != nil {
 		return err
@@ -114,8 +114,9 @@ func (aof *AOF) readValues(iterator func(v Value)) error {
 			}
 			return err
 		}
-		if iterator != nil {
-			iterator(v)
+		if iterator != nil && !iterator(v) {
+			// stopped early, the next append must seek to the end.
+			return nil
 		}
 	}
 	if _, err := aof.f.Seek(0, 2); err != nil {
@@ -167,11 +168,18 @@ func (aof *AOF) AppendMulti(vs []Value) error {
 
 // Scan iterates though all values in the file.
 // This operation could take a long time if there lots of values, and the operation cannot be canceled part way through.
+// Use All for an iteration that can be stopped early.
 func (aof *AOF) Scan(iterator func(v Value)) error {
 	aof.mu.Lock()
 	defer aof.mu.Unlock()
 	if aof.closed {
 		return errClosed
 	}
-	return aof.readValues(iterator)
+	if iterator == nil {
+		return aof.readValues(nil)
+	}
+	return aof.readValues(func(v Value) bool {
+		iterator(v)
+		return true
+	})
 }
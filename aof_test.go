@@ -46,6 +46,9 @@ func TestAOF(t *testing.T) {
 			t.Fatal(err)
 		}
 	}
+	if err := f.Scan(nil); err != nil {
+		t.Fatal(err)
+	}
 	i := 0
 	if err := f.Scan(func(v Value) {
 		s := v.String()
@@ -0,0 +1,261 @@
+package resp
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// FormatCLI returns a human readable representation of Value in the same format as redis-cli.
+//
+//	SimpleString   OK
+//	Error          (error) ERR unknown command
+//	Integer        (integer) 3
+//	BulkString     "foo"
+//	Null           (nil)
+//	Array          1) "foo"
+//	               2) (integer) 3
+//	Empty Array    (empty array)
+//
+// Bulk strings are quoted and non-printable characters are escaped, making the output
+// safe for logs and golden files. Use ParseCLI to convert the output back into a Value.
+func FormatCLI(v Value) string {
+	b := appendCLI(nil, v, "")
+	return string(b[:len(b)-1])
+}
+
+func appendCLI(dst []byte, v Value, prefix string) []byte {
+	switch v.typ {
+	default:
+		return append(dst, "(nil)\n"...)
+	case '+':
+		dst = append(dst, v.str...)
+	case '-':
+		dst = append(dst, "(error) "...)
+		dst = append(dst, v.str...)
+	case ':':
+		dst = append(dst, "(integer) "...)
+		dst = strconv.AppendInt(dst, int64(v.integer), 10)
+	case '$':
+		if v.null {
+			return append(dst, "(nil)\n"...)
+		}
+		dst = appendCLIQuoted(dst, v.str)
+	case '*':
+		if v.null {
+			return append(dst, "(nil)\n"...)
+		}
+		if len(v.array) == 0 {
+			return append(dst, "(empty array)\n"...)
+		}
+		// Nested arrays are indented by the width of the largest index.
+		idxlen := intLen(len(v.array))
+		nprefix := prefix + strings.Repeat(" ", idxlen+2)
+		for i := 0; i < len(v.array); i++ {
+			// The first element follows the index written by the parent.
+			if i > 0 {
+				dst = append(dst, prefix...)
+			}
+			for j := intLen(i + 1); j < idxlen; j++ {
+				dst = append(dst, ' ')
+			}
+			dst = strconv.AppendInt(dst, int64(i+1), 10)
+			dst = append(dst, ')', ' ')
+			dst = appendCLI(dst, v.array[i], nprefix)
+		}
+		return dst
+	}
+	return append(dst, '\n')
+}
+
+func appendCLIQuoted(dst []byte, b []byte) []byte {
+	dst = append(dst, '"')
+	for _, c := range b {
+		switch c {
+		case '\\', '"':
+			dst = append(dst, '\\', c)
+		case '\n':
+			dst = append(dst, '\\', 'n')
+		case '\r':
+			dst = append(dst, '\\', 'r')
+		case '\t':
+			dst = append(dst, '\\', 't')
+		case '\a':
+			dst = append(dst, '\\', 'a')
+		case '\b':
+			dst = append(dst, '\\', 'b')
+		default:
+			if c < ' ' || c > '~' {
+				dst = append(dst, '\\', 'x', hexdigits[c>>4], hexdigits[c&15])
+			} else {
+				dst = append(dst, c)
+			}
+		}
+	}
+	return append(dst, '"')
+}
+
+const hexdigits = "0123456789abcdef"
+
+type errCLI struct {
+	line int
+	msg  string
+}
+
+func (err errCLI) Error() string {
+	return "invalid cli format on line " + strconv.Itoa(err.line+1) + ": " + err.msg
+}
+
+// ParseCLI parses text that is in the redis-cli format, such as the output of FormatCLI, and returns a Value.
+//
+// The format does not distinguish between a null bulk string and a null array, which are both returned as
+// a null bulk string. Unquoted lines are returned as simple strings.
+func ParseCLI(s string) (Value, error) {
+	lines := strings.Split(strings.TrimRight(s, "\r\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+	v, i, err := parseCLI(lines, 0, lines[0], 0)
+	if err != nil {
+		return nullValue, err
+	}
+	if i < len(lines) {
+		return nullValue, &errCLI{i, "unexpected line"}
+	}
+	return v, nil
+}
+
+// parseCLI parses the value that starts with the text in first, which is the remainder
+// of lines[i]. The following lines of a nested value are indented by indent spaces.
+// Returns the value and the index of the next line.
+func parseCLI(lines []string, i int, first string, indent int) (Value, int, error) {
+	idx, w, ok := parseCLIIndex(first)
+	if !ok {
+		v, err := parseCLIScalar(first)
+		if err != nil {
+			return nullValue, i, &errCLI{i, err.Error()}
+		}
+		return v, i + 1, nil
+	}
+	if idx != 1 {
+		return nullValue, i, &errCLI{i, "expected index 1"}
+	}
+	var vals []Value
+	line := first
+	for {
+		v, next, err := parseCLI(lines, i, line[w:], indent+w)
+		if err != nil {
+			return nullValue, i, err
+		}
+		vals = append(vals, v)
+		i = next
+		if i == len(lines) {
+			break
+		}
+		// The next element must have the same indentation and index width.
+		line = lines[i]
+		if len(line) < indent || strings.TrimLeft(line[:indent], " ") != "" {
+			break
+		}
+		line = line[indent:]
+		nidx, nw, ok := parseCLIIndex(line)
+		if !ok || nidx != idx+1 || nw != w {
+			break
+		}
+		idx = nidx
+	}
+	return ArrayValue(vals), i, nil
+}
+
+// parseCLIIndex parses an array index prefix, such as " 1) ". Returns the index
+// and the width of the prefix.
+func parseCLIIndex(s string) (idx, w int, ok bool) {
+	for w < len(s) && s[w] == ' ' {
+		w++
+	}
+	start := w
+	for w < len(s) && s[w] >= '0' && s[w] <= '9' {
+		w++
+	}
+	if w == start || w+1 >= len(s) || s[w] != ')' || s[w+1] != ' ' {
+		return 0, 0, false
+	}
+	idx, err := strconv.Atoi(s[start:w])
+	if err != nil {
+		return 0, 0, false
+	}
+	return idx, w + 2, true
+}
+
+func parseCLIScalar(s string) (Value, error) {
+	switch {
+	case s == "(nil)":
+		return NullValue(), nil
+	case s == "(empty array)", s == "(empty list or set)":
+		return ArrayValue([]Value{}), nil
+	case strings.HasPrefix(s, "(integer) "):
+		n, err := strconv.ParseInt(s[10:], 10, 64)
+		if err != nil {
+			return nullValue, errors.New("invalid integer")
+		}
+		return IntegerValue(int(n)), nil
+	case strings.HasPrefix(s, "(error) "):
+		return Value{typ: '-', str: []byte(s[8:])}, nil
+	case strings.HasPrefix(s, "\""):
+		b, err := parseCLIQuoted(s)
+		if err != nil {
+			return nullValue, err
+		}
+		return BytesValue(b), nil
+	}
+	return Value{typ: '+', str: []byte(s)}, nil
+}
+
+func parseCLIQuoted(s string) ([]byte, error) {
+	if len(s) < 2 || s[len(s)-1] != '"' {
+		return nil, errors.New("unbalanced quotes")
+	}
+	s = s[1 : len(s)-1]
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' {
+			return nil, errors.New("unbalanced quotes")
+		}
+		if c != '\\' {
+			b = append(b, c)
+			continue
+		}
+		i++
+		if i == len(s) {
+			return nil, errors.New("invalid escape sequence")
+		}
+		switch s[i] {
+		default:
+			return nil, errors.New("invalid escape sequence")
+		case '\\', '"':
+			b = append(b, s[i])
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case 't':
+			b = append(b, '\t')
+		case 'a':
+			b = append(b, '\a')
+		case 'b':
+			b = append(b, '\b')
+		case 'x':
+			if i+3 > len(s) {
+				return nil, errors.New("invalid escape sequence")
+			}
+			n, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, errors.New("invalid escape sequence")
+			}
+			b = append(b, byte(n))
+			i += 2
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,89 @@
+package resp
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFormatCLI(t *testing.T) {
+	var tests = []struct {
+		v   Value
+		out string
+	}{
+		{SimpleStringValue("OK"), "OK"},
+		{ErrorValue(errors.New("ERR unknown command")), "(error) ERR unknown command"},
+		{IntegerValue(-3), "(integer) -3"},
+		{StringValue("foo"), `"foo"`},
+		{StringValue("a \"b\"\r\n\t\\\x00\xff"), `"a \"b\"\r\n\t\\\x00\xff"`},
+		{NullValue(), "(nil)"},
+		{Value{typ: '*', null: true}, "(nil)"},
+		{ArrayValue(nil), "(empty array)"},
+		{MultiBulkValue("SET", "key", 1), "1) \"SET\"\n2) \"key\"\n3) \"1\""},
+		{ArrayValue([]Value{
+			ArrayValue([]Value{IntegerValue(1), StringValue("a")}),
+			ArrayValue(nil),
+			ArrayValue([]Value{ArrayValue([]Value{NullValue(), SimpleStringValue("OK")})}),
+		}), "" +
+			"1) 1) (integer) 1\n" +
+			"   2) \"a\"\n" +
+			"2) (empty array)\n" +
+			"3) 1) 1) (nil)\n" +
+			"      2) OK",
+		},
+	}
+	for i, test := range tests {
+		out := FormatCLI(test.v)
+		if out != test.out {
+			t.Fatalf("#%d: expected\n%v\ngot\n%v", i, test.out, out)
+		}
+		v, err := ParseCLI(out)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if FormatCLI(v) != out {
+			t.Fatalf("#%d: expected\n%v\ngot\n%v", i, out, FormatCLI(v))
+		}
+	}
+}
+
+func TestFormatCLIWideIndexes(t *testing.T) {
+	var vals []Value
+	for i := 0; i < 12; i++ {
+		vals = append(vals, ArrayValue([]Value{StringValue(fmt.Sprint(i)), IntegerValue(i)}))
+	}
+	v := ArrayValue([]Value{ArrayValue(vals), StringValue("last")})
+	out := FormatCLI(v)
+	exp := "" +
+		"1)  1) 1) \"0\"\n" +
+		"       2) (integer) 0\n" +
+		"    2) 1) \"1\"\n"
+	if out[:len(exp)] != exp {
+		t.Fatalf("expected\n%v\ngot\n%v", exp, out[:len(exp)])
+	}
+	pv, err := ParseCLI(out + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pv.Equals(v) {
+		t.Fatalf("expected '%v', got '%v'", v, pv)
+	}
+}
+
+func TestParseCLI(t *testing.T) {
+	v, err := ParseCLI("1) \"a\"\r\n2) (integer) 2\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Equals(ArrayValue([]Value{StringValue("a"), IntegerValue(2)})) {
+		t.Fatalf("unexpected value '%v'", v)
+	}
+	for _, s := range []string{
+		"\"abc", "\"a\"b\"", "\"\\q\"", "\"\\x4\"", "(integer) abc",
+		"1) OK\n3) OK", "2) OK", "OK\nOK",
+	} {
+		if _, err := ParseCLI(s); err == nil {
+			t.Fatalf("expected error for '%v'", s)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package resp
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Name returns the name of the connection, which is set by the CLIENT SETNAME command.
+func (conn *Conn) Name() string {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return conn.name
+}
+
+// SetName sets the name of the connection.
+func (conn *Conn) SetName(name string) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.name = name
+}
+
+// User returns the authenticated user of the connection, or "default" when no user is set.
+func (conn *Conn) User() string {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.user == "" {
+		return "default"
+	}
+	return conn.user
+}
+
+// SetUser sets the authenticated user of the connection, such as after a successful AUTH command.
+// The user is shown by CLIENT LIST and can be used by CLIENT KILL USER.
+func (conn *Conn) SetUser(user string) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.user = user
+}
+
+// setCommand records the command that the connection is running.
+func (conn *Conn) setCommand(commandName string) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.lastCmd = commandName
+	conn.lastActive = time.Now()
+}
+
+// info returns the connection in the format of CLIENT LIST and CLIENT INFO.
+func (conn *Conn) info(now time.Time) string {
+	conn.mu.Lock()
+	name, lastCmd, lastActive := conn.name, conn.lastCmd, conn.lastActive
+	conn.mu.Unlock()
+	if lastActive.IsZero() {
+		lastActive = conn.Created
+	}
+	if lastCmd == "" {
+		lastCmd = "NULL"
+	}
+	return "id=" + strconv.FormatUint(conn.ID, 10) +
+		" addr=" + conn.RemoteAddr +
+		" laddr=" + conn.LocalAddr +
+		" name=" + name +
+		" age=" + strconv.FormatInt(int64(now.Sub(conn.Created)/time.Second), 10) +
+		" idle=" + strconv.FormatInt(int64(now.Sub(lastActive)/time.Second), 10) +
+		" flags=N" +
+		" cmd=" + lastCmd +
+		" user=" + conn.User() + "\n"
+}
+
+// Conns returns all connections that are currently served, ordered by ID.
+func (s *Server) Conns() []*Conn {
+	s.lmu.Lock()
+	conns := make([]*Conn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.lmu.Unlock()
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].ID < conns[j].ID
+	})
+	return conns
+}
+
+// Kill closes a connection that's served by the server. The command that is currently
+// running on the connection, if any, is allowed to finish.
+func (s *Server) Kill(conn *Conn) {
+	conn.state.Store(connClosed)
+	conn.base.Close()
+}
+
+// Pause suspends the processing of commands from all clients for the duration d.
+// Commands that are received during the pause are delayed until it ends. The CLIENT command
+// is not affected, allowing for a CLIENT UNPAUSE.
+func (s *Server) Pause(d time.Duration) {
+	s.pauseUntil.Store(time.Now().Add(d).UnixNano())
+}
+
+// Unpause resumes the processing of commands that were suspended by Pause.
+func (s *Server) Unpause() {
+	s.pauseUntil.Store(0)
+}
+
+// waitPause blocks while the server is paused.
+func (s *Server) waitPause() {
+	for {
+		until := s.pauseUntil.Load()
+		if until == 0 {
+			return
+		}
+		wait := time.Duration(until - time.Now().UnixNano())
+		if wait <= 0 {
+			return
+		}
+		if wait > time.Millisecond*10 {
+			// check for an unpause every now and then
+			wait = time.Millisecond * 10
+		}
+		time.Sleep(wait)
+	}
+}
+
+var errNoSuchClient = NewRedisError("ERR", "No such client")
+
+// handleClientCommands registers the built-in CLIENT subcommands.
+func (s *Server) handleClientCommands(mux *ServeMux) {
+	mux.HandleCommand(Command{Name: "client|id", Arity: 2}, func(conn *Conn, args []Value) bool {
+		conn.WriteInteger(int(conn.ID))
+		return true
+	})
+	mux.HandleCommand(Command{Name: "client|info", Arity: 2}, func(conn *Conn, args []Value) bool {
+		conn.WriteString(conn.info(time.Now()))
+		return true
+	})
+	mux.HandleCommand(Command{Name: "client|getname", Arity: 2}, func(conn *Conn, args []Value) bool {
+		if name := conn.Name(); name == "" {
+			conn.WriteNull()
+		} else {
+			conn.WriteString(name)
+		}
+		return true
+	})
+	mux.HandleCommand(Command{Name: "client|setname", Arity: 3}, clientSetName)
+	mux.HandleCommand(Command{Name: "client|list", Arity: -2, Flags: CommandAdmin}, s.clientList)
+	mux.HandleCommand(Command{Name: "client|kill", Arity: -3, Flags: CommandAdmin}, s.clientKill)
+	mux.HandleCommand(Command{Name: "client|pause", Arity: -3, Flags: CommandAdmin}, s.clientPause)
+	mux.HandleCommand(Command{Name: "client|unpause", Arity: 2, Flags: CommandAdmin}, func(conn *Conn, args []Value) bool {
+		s.Unpause()
+		conn.WriteSimpleString("OK")
+		return true
+	})
+}
+
+// clientSetName is the CLIENT SETNAME name command.
+func clientSetName(conn *Conn, args []Value) bool {
+	name := args[2].String()
+	for i := 0; i < len(name); i++ {
+		if name[i] <= ' ' || name[i] > '~' {
+			conn.WriteError(NewRedisError("ERR", "Client names cannot contain spaces, newlines or special characters."))
+			return true
+		}
+	}
+	conn.SetName(name)
+	conn.WriteSimpleString("OK")
+	return true
+}
+
+// clientPause is the CLIENT PAUSE timeout [ALL] command.
+func (s *Server) clientPause(conn *Conn, args []Value) bool {
+	if len(args) > 4 {
+		conn.WriteError(ErrWrongNumberOfArgs("client|pause"))
+		return true
+	}
+	ms, err := strconv.ParseInt(args[2].String(), 10, 64)
+	if err != nil || ms < 0 {
+		conn.WriteError(NewRedisError("ERR", "timeout is not an integer or out of range"))
+		return true
+	}
+	if len(args) == 4 && strings.ToLower(args[3].String()) != "all" {
+		conn.WriteError(ErrSyntax())
+		return true
+	}
+	s.Pause(time.Duration(ms) * time.Millisecond)
+	conn.WriteSimpleString("OK")
+	return true
+}
+
+// clientList is the CLIENT LIST [ID id [id ...]] command.
+func (s *Server) clientList(conn *Conn, args []Value) bool {
+	var ids map[uint64]bool
+	if len(args) > 2 {
+		if strings.ToLower(args[2].String()) != "id" || len(args) == 3 {
+			conn.WriteError(ErrSyntax())
+			return true
+		}
+		ids = make(map[uint64]bool)
+		for _, arg := range args[3:] {
+			id, err := strconv.ParseUint(arg.String(), 10, 64)
+			if err != nil {
+				conn.WriteError(NewRedisError("ERR", "Invalid client ID"))
+				return true
+			}
+			ids[id] = true
+		}
+	}
+	now := time.Now()
+	var list []byte
+	for _, c := range s.Conns() {
+		if ids == nil || ids[c.ID] {
+			list = append(list, c.info(now)...)
+		}
+	}
+	conn.WriteBytes(list)
+	return true
+}
+
+// clientKill is the CLIENT KILL command, in either the old form, CLIENT KILL addr,
+// or the new form, CLIENT KILL [ID id] [ADDR addr] [LADDR addr] [USER user] [SKIPME yes/no].
+func (s *Server) clientKill(conn *Conn, args []Value) bool {
+	var id uint64
+	var addr, laddr, user string
+	skipme := true
+	oldForm := len(args) == 3
+	if oldForm {
+		addr = args[2].String()
+	} else {
+		if len(args)%2 != 0 {
+			conn.WriteError(ErrSyntax())
+			return true
+		}
+		for i := 2; i < len(args); i += 2 {
+			val := args[i+1].String()
+			switch strings.ToLower(args[i].String()) {
+			default:
+				conn.WriteError(ErrSyntax())
+				return true
+			case "id":
+				n, err := strconv.ParseUint(val, 10, 64)
+				if err != nil || n == 0 {
+					conn.WriteError(NewRedisError("ERR", "client-id should be greater than 0"))
+					return true
+				}
+				id = n
+			case "addr":
+				addr = val
+			case "laddr":
+				laddr = val
+			case "user":
+				user = val
+			case "skipme":
+				switch strings.ToLower(val) {
+				default:
+					conn.WriteError(ErrSyntax())
+					return true
+				case "yes":
+					skipme = true
+				case "no":
+					skipme = false
+				}
+			}
+		}
+	}
+	var killed int
+	var self bool
+	for _, c := range s.Conns() {
+		if (id != 0 && c.ID != id) || (addr != "" && c.RemoteAddr != addr) ||
+			(laddr != "" && c.LocalAddr != laddr) || (user != "" && c.User() != user) {
+			continue
+		}
+		if c == conn {
+			if skipme && !oldForm {
+				continue
+			}
+			// close this connection after replying
+			self = true
+		} else {
+			s.Kill(c)
+		}
+		killed++
+	}
+	if oldForm {
+		if killed == 0 {
+			conn.WriteError(errNoSuchClient)
+		} else {
+			conn.WriteSimpleString("OK")
+		}
+	} else {
+		conn.WriteInteger(killed)
+	}
+	return !self
+}
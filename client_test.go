@@ -0,0 +1,190 @@
+package resp
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testClientServer(t *testing.T) (*Server, func() *Conn) {
+	s := NewServer()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	return s, func() *Conn {
+		nconn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { nconn.Close() })
+		return NewConn(nconn)
+	}
+}
+
+func do(t *testing.T, conn *Conn, args ...interface{}) Value {
+	t.Helper()
+	if err := conn.WriteMultiBulk(args[0].(string), args[1:]...); err != nil {
+		t.Fatal(err)
+	}
+	v, _, err := conn.ReadValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestClientCommands(t *testing.T) {
+	_, dial := testClientServer(t)
+	c1, c2 := dial(), dial()
+	id1, id2 := do(t, c1, "CLIENT", "ID").Integer(), do(t, c2, "client", "id").Integer()
+	if id1 == 0 || id2 != id1+1 {
+		t.Fatalf("unexpected ids %v and %v", id1, id2)
+	}
+	if v := do(t, c1, "CLIENT", "GETNAME"); !v.IsNull() {
+		t.Fatalf("expected null, got '%v'", v)
+	}
+	if v := do(t, c1, "CLIENT", "SETNAME", "bad name"); v.Error() == nil {
+		t.Fatalf("expected error, got '%v'", v)
+	}
+	if v := do(t, c1, "CLIENT", "SETNAME", "worker"); v.String() != "OK" {
+		t.Fatalf("expected 'OK', got '%v'", v)
+	}
+	if v := do(t, c1, "CLIENT", "GETNAME"); v.String() != "worker" {
+		t.Fatalf("expected 'worker', got '%v'", v)
+	}
+	info := do(t, c1, "CLIENT", "INFO").String()
+	if !strings.HasPrefix(info, "id="+do(t, c1, "CLIENT", "ID").String()+" ") ||
+		!strings.Contains(info, " name=worker ") || !strings.Contains(info, " cmd=client ") ||
+		!strings.HasSuffix(info, " user=default\n") {
+		t.Fatalf("unexpected info '%v'", info)
+	}
+	list := do(t, c2, "CLIENT", "LIST").String()
+	if strings.Count(list, "\n") != 2 || !strings.Contains(list, " name=worker ") {
+		t.Fatalf("unexpected list '%v'", list)
+	}
+	list = do(t, c2, "CLIENT", "LIST", "ID", id2).String()
+	if strings.Count(list, "\n") != 1 || strings.Contains(list, " name=worker ") {
+		t.Fatalf("unexpected list '%v'", list)
+	}
+	if v := do(t, c1, "CLIENT", "HELP"); len(v.Array()) != 11 {
+		t.Fatalf("unexpected help '%v'", v)
+	}
+	for _, args := range [][]interface{}{
+		{"CLIENT"}, {"CLIENT", "FOO"}, {"CLIENT", "ID", "1"}, {"CLIENT", "LIST", "TYPE"},
+		{"CLIENT", "KILL", "ID", "abc"}, {"CLIENT", "KILL", "ID"}, {"CLIENT", "PAUSE", "abc"},
+	} {
+		if v := do(t, c1, args...); v.Error() == nil {
+			t.Fatalf("expected error for %v, got '%v'", args, v)
+		}
+	}
+}
+
+func TestClientKill(t *testing.T) {
+	s, dial := testClientServer(t)
+	c1, c2, c3 := dial(), dial(), dial()
+	do(t, c3, "PING")
+	id2 := do(t, c2, "CLIENT", "ID").Integer()
+	if v := do(t, c1, "CLIENT", "KILL", "ID", id2); v.Integer() != 1 {
+		t.Fatalf("expected 1, got '%v'", v)
+	}
+	if _, _, err := c2.ReadValue(); err != io.EOF {
+		t.Fatalf("expected '%v', got '%v'", io.EOF, err)
+	}
+	// old form by address
+	if v := do(t, c1, "CLIENT", "KILL", c3.LocalAddr); v.String() != "OK" {
+		t.Fatalf("expected 'OK', got '%v'", v)
+	}
+	if v := do(t, c1, "CLIENT", "KILL", c3.LocalAddr); v.String() != "ERR No such client" {
+		t.Fatalf("expected 'ERR No such client', got '%v'", v)
+	}
+	// by user, skipping this connection
+	c4 := dial()
+	do(t, c4, "PING")
+	if v := do(t, c1, "CLIENT", "KILL", "USER", "default"); v.Integer() != 1 {
+		t.Fatalf("expected 1, got '%v'", v)
+	}
+	if _, _, err := c4.ReadValue(); err != io.EOF {
+		t.Fatalf("expected '%v', got '%v'", io.EOF, err)
+	}
+	// killed connections leave the registry once their goroutine exits
+	for start := time.Now(); len(s.Conns()) != 1; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("expected 1, got %v", len(s.Conns()))
+		}
+	}
+	// this connection
+	if v := do(t, c1, "CLIENT", "KILL", "USER", "default", "SKIPME", "no"); v.Integer() != 1 {
+		t.Fatalf("expected 1, got '%v'", v)
+	}
+	if _, _, err := c1.ReadValue(); err != io.EOF {
+		t.Fatalf("expected '%v', got '%v'", io.EOF, err)
+	}
+}
+
+func TestClientPause(t *testing.T) {
+	_, dial := testClientServer(t)
+	c1, c2 := dial(), dial()
+	if v := do(t, c1, "CLIENT", "PAUSE", 100, "ALL"); v.String() != "OK" {
+		t.Fatalf("expected 'OK', got '%v'", v)
+	}
+	start := time.Now()
+	do(t, c2, "PING")
+	if time.Since(start) < time.Millisecond*50 {
+		t.Fatal("expected command to be paused")
+	}
+	do(t, c1, "CLIENT", "PAUSE", 10000)
+	go func() {
+		time.Sleep(time.Millisecond * 20)
+		c1.WriteMultiBulk("CLIENT", "UNPAUSE")
+	}()
+	start = time.Now()
+	do(t, c2, "PING")
+	if time.Since(start) > time.Second {
+		t.Fatal("expected command to be unpaused")
+	}
+}
+
+func TestClientSubcommands(t *testing.T) {
+	s, dial := testClientServer(t)
+	s.HandleSubFunc("CLIENT", "NO-EVICT", func(conn *Conn, args []Value) bool {
+		conn.WriteSimpleString("OK")
+		return true
+	})
+	s.HandleSubFunc("client", "getname", func(conn *Conn, args []Value) bool {
+		conn.WriteString("custom")
+		return true
+	})
+	conn := dial()
+	if v := do(t, conn, "CLIENT", "ID"); v.Integer() == 0 {
+		t.Fatalf("expected an id, got '%v'", v)
+	}
+	if v := do(t, conn, "CLIENT", "NO-EVICT", "on"); v.String() != "OK" {
+		t.Fatalf("expected 'OK', got '%v'", v)
+	}
+	if v := do(t, conn, "CLIENT", "GETNAME"); v.String() != "custom" {
+		t.Fatalf("expected 'custom', got '%v'", v)
+	}
+	if v := do(t, conn, "CLIENT", "FOO"); v.String() != "ERR unknown subcommand 'FOO'. Try CLIENT HELP." {
+		t.Fatalf("unexpected reply '%v'", v)
+	}
+	help := do(t, conn, "CLIENT", "HELP").String()
+	if !strings.Contains(help, " ID ") || !strings.Contains(help, " NO-EVICT ") {
+		t.Fatalf("unexpected help '%v'", help)
+	}
+	var subs []string
+	for _, sub := range findCommand(s.Commands(), "client").Subcommands {
+		subs = append(subs, sub.Name)
+	}
+	exp := "client|getname client|id client|info client|kill client|list client|no-evict client|pause client|setname client|unpause"
+	if strings.Join(subs, " ") != exp {
+		t.Fatalf("expected '%v', got '%v'", exp, subs)
+	}
+	if v := do(t, conn, "COMMAND", "INFO", "client|id"); v.String() != "[[client|id 2 [] 0 0 0]]" {
+		t.Fatalf("unexpected info '%v'", v)
+	}
+}
@@ -0,0 +1,234 @@
+package resp
+
+import (
+	"sort"
+	"strings"
+)
+
+// CommandFlags are the flags of a command, which are reported by COMMAND INFO.
+type CommandFlags int
+
+const (
+	// CommandWrite is a command that may modify data.
+	CommandWrite CommandFlags = 1 << iota
+	// CommandReadonly is a command that only reads data.
+	CommandReadonly
+	// CommandAdmin is an administrative command, such as CONFIG or CLIENT KILL.
+	CommandAdmin
+	// CommandFast is a command that runs in constant or logarithmic time.
+	CommandFast
+)
+
+var commandFlagNames = []string{"write", "readonly", "admin", "fast"}
+
+// names returns the names of the flags, such as "write" and "fast".
+func (flags CommandFlags) names() []string {
+	var names []string
+	for i, name := range commandFlagNames {
+		if flags&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Command describes a command for automatic arity checks and for the COMMAND command.
+type Command struct {
+	// Name is the name of the command, such as "get". A subcommand is named after its command
+	// and a pipe, such as "config|get".
+	Name string
+
+	// Arity is the number of arguments, including the command name, and the subcommand name of a
+	// subcommand. A negative arity is the minimum number of arguments. Zero means any number of arguments.
+	// Commands with the wrong number of arguments are sent an error without calling the handler.
+	Arity int
+
+	// Flags are the flags of the command.
+	Flags CommandFlags
+
+	// FirstKey is the position of the first key argument, or zero when the command has no keys.
+	// LastKey is the position of the last key argument, where -1 is the last argument, and -2 the one
+	// before that. KeyStep is the distance between keys, such as 2 for MSET key value [key value ...].
+	FirstKey, LastKey, KeyStep int
+
+	// Subcommands are the registered subcommands. It's only set by the Commands methods.
+	Subcommands []Command
+}
+
+// checkArity reports whether n arguments match the arity of the command.
+func (cmd *Command) checkArity(n int) bool {
+	if cmd.Arity < 0 {
+		return n >= -cmd.Arity
+	}
+	return cmd.Arity == 0 || n == cmd.Arity
+}
+
+// Keys returns the key arguments of a call of the command, as described by FirstKey, LastKey, and KeyStep.
+func (cmd Command) Keys(args []Value) []Value {
+	if cmd.FirstKey <= 0 {
+		return nil
+	}
+	last := cmd.LastKey
+	if last < 0 {
+		last += len(args)
+	}
+	step := cmd.KeyStep
+	if step <= 0 {
+		step = 1
+	}
+	var keys []Value
+	for i := cmd.FirstKey; i <= last && i < len(args); i += step {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// info returns the command in the format of COMMAND INFO, which is an array of the name,
+// arity, flags, first key, last key, and key step.
+func (cmd *Command) info() Value {
+	var flags []Value
+	for _, flag := range cmd.Flags.names() {
+		flags = append(flags, SimpleStringValue(flag))
+	}
+	return ArrayValue([]Value{
+		StringValue(cmd.Name),
+		IntegerValue(cmd.Arity),
+		ArrayValue(flags),
+		IntegerValue(cmd.FirstKey),
+		IntegerValue(cmd.LastKey),
+		IntegerValue(cmd.KeyStep),
+	})
+}
+
+// findCommand returns the command or subcommand with the name, such as "get" or "config|get".
+func findCommand(cmds []Command, name string) *Command {
+	name = strings.ToLower(name)
+	parent := name
+	if i := strings.IndexByte(name, '|'); i >= 0 {
+		parent = name[:i]
+	}
+	for i := range cmds {
+		if cmds[i].Name == name {
+			return &cmds[i]
+		}
+		if cmds[i].Name == parent {
+			return findCommand(cmds[i].Subcommands, name)
+		}
+	}
+	return nil
+}
+
+// command returns the description of the command that is registered with the entry.
+func (e *handlerEntry) command(name string) Command {
+	cmd := Command{Name: strings.ToLower(name), Arity: -1}
+	if e.cmd != nil {
+		cmd = *e.cmd
+	}
+	if e.subs != nil {
+		cmd.Arity = -2
+		for sub, se := range e.subs.handlers {
+			if sub == "" {
+				// the command runs without a subcommand too
+				cmd.Arity = -1
+				continue
+			}
+			subcmd := se.command(cmd.Name + "|" + sub)
+			if se.cmd == nil {
+				subcmd.Arity = -2
+			}
+			cmd.Subcommands = append(cmd.Subcommands, subcmd)
+		}
+		sortCommands(cmd.Subcommands)
+	}
+	return cmd
+}
+
+func sortCommands(cmds []Command) {
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].Name < cmds[j].Name
+	})
+}
+
+// Commands returns the description of all the commands that are served by the server, including
+// the built-in commands, ordered by name. Commands that were registered without a Command are
+// described by their name alone.
+func (s *Server) Commands() []Command {
+	cmds := s.mux.Commands()
+	for _, cmd := range s.builtins.Commands() {
+		found := findCommand(cmds, cmd.Name)
+		if found == nil {
+			cmds = append(cmds, cmd)
+			continue
+		}
+		if len(found.Subcommands) == 0 {
+			// replaced by a command without subcommands
+			continue
+		}
+		// the subcommands of the server fall back to the built-in subcommands
+		for _, sub := range cmd.Subcommands {
+			if findCommand(found.Subcommands, sub.Name) == nil {
+				found.Subcommands = append(found.Subcommands, sub)
+			}
+		}
+		sortCommands(found.Subcommands)
+		if cmd.Arity == -1 {
+			found.Arity = -1
+		}
+	}
+	sortCommands(cmds)
+	return cmds
+}
+
+// handleCommandCommands registers the built-in COMMAND command.
+func (s *Server) handleCommandCommands(mux *ServeMux) {
+	mux.HandleSubFunc("COMMAND", "", func(conn *Conn, args []Value) bool {
+		var info []Value
+		cmds := s.Commands()
+		for i := range cmds {
+			info = append(info, cmds[i].info())
+		}
+		conn.WriteArray(info)
+		return true
+	})
+	mux.HandleCommand(Command{Name: "command|count", Arity: 2}, func(conn *Conn, args []Value) bool {
+		conn.WriteInteger(len(s.Commands()))
+		return true
+	})
+	mux.HandleCommand(Command{Name: "command|info", Arity: -2}, func(conn *Conn, args []Value) bool {
+		var info []Value
+		cmds := s.Commands()
+		for _, arg := range args[2:] {
+			if cmd := findCommand(cmds, arg.String()); cmd != nil {
+				info = append(info, cmd.info())
+			} else {
+				info = append(info, NullValue())
+			}
+		}
+		conn.WriteArray(info)
+		return true
+	})
+	mux.HandleCommand(Command{Name: "command|getkeys", Arity: -3}, func(conn *Conn, args []Value) bool {
+		args = args[2:]
+		cmd := findCommand(s.Commands(), args[0].String())
+		if cmd == nil {
+			conn.WriteError(NewRedisError("ERR", "Invalid command specified"))
+			return true
+		}
+		if len(cmd.Subcommands) > 0 && len(args) > 1 {
+			if sub := findCommand(cmd.Subcommands, cmd.Name+"|"+args[1].String()); sub != nil {
+				cmd = sub
+			}
+		}
+		if !cmd.checkArity(len(args)) {
+			conn.WriteError(NewRedisError("ERR", "Invalid number of arguments specified for command"))
+			return true
+		}
+		keys := cmd.Keys(args)
+		if len(keys) == 0 {
+			conn.WriteError(NewRedisError("ERR", "The command has no key arguments"))
+			return true
+		}
+		conn.WriteArray(keys)
+		return true
+	})
+}
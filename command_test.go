@@ -0,0 +1,123 @@
+package resp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommandArity(t *testing.T) {
+	var calls int
+	handler := func(conn *Conn, args []Value) bool {
+		calls++
+		conn.WriteSimpleString("OK")
+		return true
+	}
+	mux := NewServeMux()
+	mux.HandleCommand(Command{Name: "GET", Arity: 2}, handler)
+	mux.HandleCommand(Command{Name: "del", Arity: -2}, handler)
+	mux.HandleCommand(Command{Name: "config|get", Arity: -3}, handler)
+	mux.HandleCommand(Command{Name: "any"}, handler)
+	for _, test := range []struct {
+		args  string
+		reply string
+	}{
+		{"get key", "OK"},
+		{"get", "ERR wrong number of arguments for 'get' command"},
+		{"GET key key", "ERR wrong number of arguments for 'get' command"},
+		{"del key", "OK"},
+		{"del key key key", "OK"},
+		{"del", "ERR wrong number of arguments for 'del' command"},
+		{"config get port", "OK"},
+		{"config get", "ERR wrong number of arguments for 'config|get' command"},
+		{"any", "OK"},
+	} {
+		calls = 0
+		v, _ := serveMux(t, mux, strings.Fields(test.args)...)
+		if v.String() != test.reply {
+			t.Fatalf("%s: expected '%v', got '%v'", test.args, test.reply, v)
+		}
+		if exp := test.reply == "OK"; (calls == 1) != exp {
+			t.Fatalf("%s: expected call %v, got %v", test.args, exp, calls)
+		}
+	}
+}
+
+func TestCommandKeys(t *testing.T) {
+	var args []Value
+	for _, arg := range strings.Fields("mset k1 v1 k2 v2 k3 v3") {
+		args = append(args, StringValue(arg))
+	}
+	for _, test := range []struct {
+		cmd  Command
+		keys string
+	}{
+		{Command{FirstKey: 1, LastKey: -1, KeyStep: 2}, "k1 k2 k3"},
+		{Command{FirstKey: 1, LastKey: 1, KeyStep: 1}, "k1"},
+		{Command{FirstKey: 1, LastKey: -2}, "k1 v1 k2 v2 k3"},
+		{Command{FirstKey: 3, LastKey: 100, KeyStep: 2}, "k2 k3"},
+		{Command{}, ""},
+	} {
+		var keys []string
+		for _, key := range test.cmd.Keys(args) {
+			keys = append(keys, key.String())
+		}
+		if strings.Join(keys, " ") != test.keys {
+			t.Fatalf("%+v: expected '%v', got '%v'", test.cmd, test.keys, keys)
+		}
+	}
+}
+
+func TestCommandCommand(t *testing.T) {
+	s, dial := testClientServer(t)
+	noop := func(conn *Conn, args []Value) bool {
+		conn.WriteSimpleString("OK")
+		return true
+	}
+	s.HandleCommand(Command{Name: "mset", Arity: -3, Flags: CommandWrite, FirstKey: 1, LastKey: -1, KeyStep: 2}, noop)
+	s.HandleCommand(Command{Name: "get", Arity: 2, Flags: CommandReadonly | CommandFast, FirstKey: 1, LastKey: 1, KeyStep: 1}, noop)
+	s.HandleSubFunc("config", "get", noop)
+	s.HandleFunc("flushall", noop)
+	conn := dial()
+
+	var names []string
+	for _, info := range do(t, conn, "COMMAND").Array() {
+		names = append(names, info.Array()[0].String())
+	}
+	if exp := "client command config flushall get mset ping quit"; strings.Join(names, " ") != exp {
+		t.Fatalf("expected '%v', got '%v'", exp, names)
+	}
+	if v := do(t, conn, "COMMAND", "COUNT"); v.Integer() != 8 {
+		t.Fatalf("expected 8, got '%v'", v)
+	}
+	for _, test := range [][2]string{
+		{"get", "[get 2 [readonly fast] 1 1 1]"},
+		{"MSET", "[mset -3 [write] 1 -1 2]"},
+		{"flushall", "[flushall -1 [] 0 0 0]"},
+		{"config", "[config -2 [] 0 0 0]"},
+		{"config|get", "[config|get -2 [] 0 0 0]"},
+		{"client|kill", "[client|kill -3 [admin] 0 0 0]"},
+		{"command", "[command -1 [] 0 0 0]"},
+	} {
+		v := do(t, conn, "COMMAND", "INFO", test[0]).Array()
+		if len(v) != 1 || v[0].String() != test[1] {
+			t.Fatalf("%s: expected '%v', got '%v'", test[0], test[1], v)
+		}
+	}
+	if v := do(t, conn, "COMMAND", "INFO", "get", "foo").Array(); len(v) != 2 || !v[1].IsNull() {
+		t.Fatalf("expected null, got '%v'", v)
+	}
+	if v := do(t, conn, "COMMAND", "GETKEYS", "mset", "k1", "v1", "k2", "v2"); v.String() != "[k1 k2]" {
+		t.Fatalf("expected '[k1 k2]', got '%v'", v)
+	}
+	for _, test := range [][]interface{}{
+		{"COMMAND", "GETKEYS", "foo", "bar"},
+		{"COMMAND", "GETKEYS", "get", "k1", "k2"},
+		{"COMMAND", "GETKEYS", "ping", "hello"},
+		{"COMMAND", "GETKEYS"},
+		{"COMMAND", "COUNT", "extra"},
+	} {
+		if v := do(t, conn, test...); v.Error() == nil {
+			t.Fatalf("%v: expected error, got '%v'", test, v)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package resp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// RedisError represents an error reply. By convention the first word of a Redis error is
+// an uppercase code such as ERR, WRONGTYPE, MOVED, or ASK, followed by a message.
+// RedisError is the error returned by Value.Error.
+type RedisError struct {
+	msg string
+}
+
+// NewRedisError returns a RedisError with the code and message, such as NewRedisError("ERR", "syntax error").
+func NewRedisError(code, msg string) *RedisError {
+	if code == "" {
+		return &RedisError{msg: msg}
+	}
+	return &RedisError{msg: code + " " + msg}
+}
+
+// ErrSyntax returns the error for a command with invalid arguments.
+func ErrSyntax() *RedisError { return &RedisError{msg: "ERR syntax error"} }
+
+// ErrWrongType returns the error for an operation against a key holding the wrong kind of value.
+func ErrWrongType() *RedisError {
+	return &RedisError{msg: "WRONGTYPE Operation against a key holding the wrong kind of value"}
+}
+
+// ErrWrongNumberOfArgs returns the error for a command called with the wrong number of arguments.
+func ErrWrongNumberOfArgs(command string) *RedisError {
+	return &RedisError{msg: "ERR wrong number of arguments for '" + strings.ToLower(command) + "' command"}
+}
+
+// ErrUnknownCommand returns the error for a command that does not exist.
+func ErrUnknownCommand(command string) *RedisError {
+	return &RedisError{msg: "ERR unknown command '" + command + "'"}
+}
+
+// ErrUnknownSubcommand returns the error for a subcommand that does not exist, such as CONFIG FOO.
+func ErrUnknownSubcommand(command, subcommand string) *RedisError {
+	return &RedisError{msg: "ERR unknown subcommand '" + subcommand + "'. Try " + strings.ToUpper(command) + " HELP."}
+}
+
+// ErrNoScript returns the error for an EVALSHA call of a script that does not exist.
+func ErrNoScript() *RedisError {
+	return &RedisError{msg: "NOSCRIPT No matching script. Please use EVAL."}
+}
+
+// ErrBusy returns the error for a server that is busy running a script.
+func ErrBusy() *RedisError {
+	return &RedisError{msg: "BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSCRIPT."}
+}
+
+// ErrMoved returns the error that redirects a cluster client to the node at addr which permanently serves the hash slot.
+func ErrMoved(slot int, addr string) *RedisError {
+	return &RedisError{msg: "MOVED " + strconv.Itoa(slot) + " " + addr}
+}
+
+// ErrAsk returns the error that redirects a cluster client to the node at addr for the next command only.
+func ErrAsk(slot int, addr string) *RedisError {
+	return &RedisError{msg: "ASK " + strconv.Itoa(slot) + " " + addr}
+}
+
+// Error returns the full error message, including the code.
+func (err *RedisError) Error() string {
+	return err.msg
+}
+
+// Code returns the error code, which is the first word of the message when it's in uppercase.
+// An empty string is returned when the error has no code.
+func (err *RedisError) Code() string {
+	code := err.msg
+	if i := strings.IndexByte(code, ' '); i >= 0 {
+		code = code[:i]
+	}
+	if code == "" || code[0] < 'A' || code[0] > 'Z' {
+		return ""
+	}
+	for i := 1; i < len(code); i++ {
+		c := code[i]
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' && c != '-' {
+			return ""
+		}
+	}
+	return code
+}
+
+// Message returns the error message without the code.
+func (err *RedisError) Message() string {
+	code := err.Code()
+	if code == "" {
+		return err.msg
+	}
+	return strings.TrimPrefix(err.msg[len(code):], " ")
+}
+
+// Redirect returns the hash slot and address of a MOVED or ASK error.
+// The ok return value is false for all other errors.
+func (err *RedisError) Redirect() (slot int, addr string, ok bool) {
+	switch err.Code() {
+	case "MOVED", "ASK":
+	default:
+		return 0, "", false
+	}
+	parts := strings.Split(err.msg, " ")
+	if len(parts) != 3 {
+		return 0, "", false
+	}
+	slot, perr := strconv.Atoi(parts[1])
+	if perr != nil {
+		return 0, "", false
+	}
+	return slot, parts[2], true
+}
+
+// HasCode reports whether the error has the code, such as "MOVED" or "WRONGTYPE".
+// Use errors.As to get the RedisError from a wrapped error.
+func (err *RedisError) HasCode(code string) bool {
+	return code != "" && err.Code() == code
+}
+
+// Is reports whether the target is a RedisError with the same message, allowing for
+// errors.Is(err, resp.ErrWrongType()). Errors that only share a code, such as ErrSyntax and
+// ErrUnknownCommand which both have the ERR code, do not match. Use HasCode to match by code.
+func (err *RedisError) Is(target error) bool {
+	t, ok := target.(*RedisError)
+	return ok && err.msg == t.msg
+}
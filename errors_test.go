@@ -0,0 +1,83 @@
+package resp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRedisError(t *testing.T) {
+	var tests = []struct {
+		err  *RedisError
+		msg  string
+		code string
+	}{
+		{ErrSyntax(), "ERR syntax error", "ERR"},
+		{ErrWrongType(), "WRONGTYPE Operation against a key holding the wrong kind of value", "WRONGTYPE"},
+		{ErrWrongNumberOfArgs("GET"), "ERR wrong number of arguments for 'get' command", "ERR"},
+		{ErrUnknownCommand("foo"), "ERR unknown command 'foo'", "ERR"},
+		{ErrUnknownSubcommand("config", "foo"), "ERR unknown subcommand 'foo'. Try CONFIG HELP.", "ERR"},
+		{ErrNoScript(), "NOSCRIPT No matching script. Please use EVAL.", "NOSCRIPT"},
+		{ErrBusy(), "BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSCRIPT.", "BUSY"},
+		{ErrMoved(3999, "127.0.0.1:6381"), "MOVED 3999 127.0.0.1:6381", "MOVED"},
+		{ErrAsk(3999, "127.0.0.1:6381"), "ASK 3999 127.0.0.1:6381", "ASK"},
+		{NewRedisError("CUSTOM", "my error"), "CUSTOM my error", "CUSTOM"},
+		{NewRedisError("", "Protocol error: bad"), "Protocol error: bad", ""},
+	}
+	for i, test := range tests {
+		if test.err.Error() != test.msg {
+			t.Fatalf("#%d: expected '%v', got '%v'", i, test.msg, test.err.Error())
+		}
+		if test.err.Code() != test.code {
+			t.Fatalf("#%d: expected '%v', got '%v'", i, test.code, test.err.Code())
+		}
+	}
+	if msg := ErrSyntax().Message(); msg != "syntax error" {
+		t.Fatalf("expected '%v', got '%v'", "syntax error", msg)
+	}
+	slot, addr, ok := ErrMoved(3999, "127.0.0.1:6381").Redirect()
+	if !ok || slot != 3999 || addr != "127.0.0.1:6381" {
+		t.Fatalf("unexpected redirect %v %v %v", slot, addr, ok)
+	}
+	if _, _, ok := ErrWrongType().Redirect(); ok {
+		t.Fatal("expected false")
+	}
+}
+
+func TestRedisErrorValue(t *testing.T) {
+	rd := NewReader(bytes.NewBufferString("-MOVED 3999 127.0.0.1:6381\r\n-WRONGTYPE bad\r\n"))
+	v, _, err := rd.ReadValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fmt.Errorf("wrapped: %w", v.Error())
+	if !errors.Is(err, ErrMoved(3999, "127.0.0.1:6381")) || errors.Is(err, ErrMoved(0, "")) {
+		t.Fatal("errors.Is failed")
+	}
+	var rerr *RedisError
+	if !errors.As(err, &rerr) {
+		t.Fatal("errors.As failed")
+	}
+	if !rerr.HasCode("MOVED") || rerr.HasCode("ASK") || rerr.HasCode("") {
+		t.Fatal("HasCode failed")
+	}
+	if slot, _, _ := rerr.Redirect(); slot != 3999 {
+		t.Fatalf("expected 3999, got %v", slot)
+	}
+	v, _, err = rd.ReadValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errors.Is(v.Error(), ErrWrongType()) || !errors.Is(ErrorValue(ErrWrongType()).Error(), ErrWrongType()) {
+		t.Fatal("errors.Is failed")
+	}
+	for _, err := range []error{ErrWrongNumberOfArgs("get"), ErrUnknownCommand("x"), ErrUnknownSubcommand("config", "x")} {
+		if errors.Is(err, ErrSyntax()) || !errors.Is(err, err) {
+			t.Fatalf("errors.Is failed for '%v'", err)
+		}
+	}
+	if ErrorValue(ErrWrongType()).String() != ErrWrongType().Error() {
+		t.Fatal("ErrorValue failed")
+	}
+}
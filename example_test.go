@@ -2,7 +2,6 @@ package resp
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -21,21 +20,17 @@ func ExampleServer() {
 	var mu sync.RWMutex
 	kvs := make(map[string]string)
 	s := NewServer()
-	s.HandleFunc("set", func(conn *Conn, args []Value) bool {
-		if len(args) != 3 {
-			conn.WriteError(errors.New("ERR wrong number of arguments for 'set' command"))
-		} else {
+	// The server checks the number of arguments, and answers the COMMAND command.
+	s.HandleCommand(Command{Name: "set", Arity: 3, Flags: CommandWrite, FirstKey: 1, LastKey: 1, KeyStep: 1},
+		func(conn *Conn, args []Value) bool {
 			mu.Lock()
 			kvs[args[1].String()] = args[2].String()
 			mu.Unlock()
 			conn.WriteSimpleString("OK")
-		}
-		return true
-	})
-	s.HandleFunc("get", func(conn *Conn, args []Value) bool {
-		if len(args) != 2 {
-			conn.WriteError(errors.New("ERR wrong number of arguments for 'get' command"))
-		} else {
+			return true
+		})
+	s.HandleCommand(Command{Name: "get", Arity: 2, Flags: CommandReadonly | CommandFast, FirstKey: 1, LastKey: 1, KeyStep: 1},
+		func(conn *Conn, args []Value) bool {
 			mu.RLock()
 			s, ok := kvs[args[1].String()]
 			mu.RUnlock()
@@ -44,9 +39,8 @@ func ExampleServer() {
 			} else {
 				conn.WriteString(s)
 			}
-		}
-		return true
-	})
+			return true
+		})
 	if err := s.ListenAndServe(":6380"); err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,60 @@
+//go:build go1.23
+
+package resp
+
+import (
+	"io"
+	"iter"
+)
+
+// Values returns an iterator over the values in the Reader.
+// The iteration ends when the Reader reaches io.EOF or after yielding the first error.
+//
+//	for v, err := range rd.Values() {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func (rd *Reader) Values() iter.Seq2[Value, error] {
+	return func(yield func(Value, error) bool) {
+		for {
+			v, _, err := rd.ReadValue()
+			if err != nil {
+				if err != io.EOF {
+					yield(nullValue, err)
+				}
+				return
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+// All returns an iterator over all values in the file.
+// Unlike Scan, the iteration can be stopped part way through by breaking out of the loop.
+// The iteration ends after yielding the first error. The file is locked during iteration,
+// so calling other AOF methods inside of the loop will deadlock.
+func (aof *AOF) All() iter.Seq2[Value, error] {
+	return func(yield func(Value, error) bool) {
+		aof.mu.Lock()
+		defer aof.mu.Unlock()
+		if aof.closed {
+			yield(nullValue, errClosed)
+			return
+		}
+		var stopped bool
+		err := aof.readValues(func(v Value) bool {
+			if !yield(v, nil) {
+				stopped = true
+				return false
+			}
+			return true
+		})
+		if err != nil && !stopped {
+			yield(nullValue, err)
+		}
+	}
+}
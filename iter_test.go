@@ -0,0 +1,96 @@
+//go:build go1.23
+
+package resp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestReaderValues(t *testing.T) {
+	rd := NewReader(bytes.NewBufferString(":1\r\n:2\r\n:3\r\n"))
+	var n int
+	for v, err := range rd.Values() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+		if v.Integer() != n {
+			t.Fatalf("expected %v, got %v", n, v.Integer())
+		}
+	}
+	if n != 3 {
+		t.Fatalf("expected 3, got %v", n)
+	}
+	rd = NewReader(bytes.NewBufferString(":1\r\n:2\r\n:3"))
+	var errs int
+	n = 0
+	for _, err := range rd.Values() {
+		if err != nil {
+			if err != io.ErrUnexpectedEOF {
+				t.Fatalf("expected '%v', got '%v'", io.ErrUnexpectedEOF, err)
+			}
+			errs++
+			continue
+		}
+		n++
+	}
+	if n != 2 || errs != 1 {
+		t.Fatalf("expected 2 and 1, got %v and %v", n, errs)
+	}
+}
+
+func TestAOFAll(t *testing.T) {
+	os.RemoveAll("aof.iter.tmp")
+	defer os.RemoveAll("aof.iter.tmp")
+	f, err := OpenAOF("aof.iter.tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := f.Append(StringValue(fmt.Sprintf("hello world #%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var n int
+	for v, err := range f.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.String() != fmt.Sprintf("hello world #%d", n) {
+			t.Fatalf("unexpected value '%v'", v)
+		}
+		n++
+		if n == 10 {
+			break
+		}
+	}
+	if n != 10 {
+		t.Fatalf("expected 10, got %v", n)
+	}
+	// appending after stopping early must still write to the end of the file.
+	if err := f.Append(StringValue("last")); err != nil {
+		t.Fatal(err)
+	}
+	n = 0
+	var last Value
+	for v, err := range f.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = v
+		n++
+	}
+	if n != 101 || last.String() != "last" {
+		t.Fatalf("expected 101 and 'last', got %v and '%v'", n, last)
+	}
+	f.Close()
+	for _, err := range f.All() {
+		if err == nil || err.Error() != "closed" {
+			t.Fatalf("expected 'closed', got '%v'", err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package resp
+
+import (
+	"encoding/json"
+	"errors"
+	"unicode/utf8"
+)
+
+// jsonValue is the type-tagged JSON representation of a Value.
+type jsonValue struct {
+	Type   string          `json:"type"`
+	Value  json.RawMessage `json:"value,omitempty"`
+	Base64 []byte          `json:"base64,omitempty"`
+	Null   bool            `json:"null,omitempty"`
+}
+
+var errInvalidJSON = errors.New("invalid json value")
+
+// MarshalJSON returns a lossless, type-tagged JSON representation of Value.
+//
+//	{"type":"SimpleString","value":"OK"}
+//	{"type":"Error","value":"ERR unknown command"}
+//	{"type":"Integer","value":3}
+//	{"type":"BulkString","value":"foo"}
+//	{"type":"BulkString","null":true}
+//	{"type":"Array","value":[{"type":"Integer","value":1}]}
+//
+// Strings that are not valid UTF-8 are stored as base64 in a "base64" field instead of "value".
+// Use NaturalJSON for plain JSON without the type tags.
+func (v Value) MarshalJSON() ([]byte, error) {
+	var jv jsonValue
+	var err error
+	switch v.typ {
+	default:
+		if v.typ != 0 || !v.null {
+			return nil, errUnknownType
+		}
+		jv.Type = BulkString.String()
+		jv.Null = true
+	case '+', '-', '$':
+		jv.Type = v.typ.String()
+		if v.null {
+			jv.Null = true
+		} else if utf8.Valid(v.str) {
+			jv.Value, err = json.Marshal(string(v.str))
+		} else {
+			jv.Base64 = v.str
+		}
+	case ':':
+		jv.Type = v.typ.String()
+		jv.Value, err = json.Marshal(v.integer)
+	case '*':
+		jv.Type = v.typ.String()
+		if v.null {
+			jv.Null = true
+		} else if v.array == nil {
+			jv.Value = json.RawMessage("[]")
+		} else {
+			jv.Value, err = json.Marshal(v.array)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jv)
+}
+
+// UnmarshalJSON sets Value from the type-tagged JSON representation produced by MarshalJSON.
+func (v *Value) UnmarshalJSON(data []byte) error {
+	var jv jsonValue
+	if err := json.Unmarshal(data, &jv); err != nil {
+		return err
+	}
+	var nv Value
+	switch jv.Type {
+	default:
+		return errInvalidJSON
+	case "SimpleString":
+		nv.typ = SimpleString
+	case "Error":
+		nv.typ = Error
+	case "Integer":
+		nv.typ = Integer
+	case "BulkString":
+		nv.typ = BulkString
+	case "Array":
+		nv.typ = Array
+	}
+	switch {
+	case jv.Null:
+		if nv.typ != BulkString && nv.typ != Array {
+			return errInvalidJSON
+		}
+		nv.null = true
+	case nv.typ == Integer:
+		if err := json.Unmarshal(jv.Value, &nv.integer); err != nil {
+			return err
+		}
+	case nv.typ == Array:
+		if err := json.Unmarshal(jv.Value, &nv.array); err != nil {
+			return err
+		}
+		if nv.array == nil {
+			return errInvalidJSON
+		}
+	case jv.Base64 != nil:
+		nv.str = jv.Base64
+	default:
+		var s string
+		if err := json.Unmarshal(jv.Value, &s); err != nil {
+			return err
+		}
+		nv.str = []byte(s)
+	}
+	*v = nv
+	return nil
+}
+
+// NaturalJSON returns a plain JSON representation of Value. Simple strings and bulk strings
+// become JSON strings, integers become numbers, nulls become null, arrays become JSON arrays,
+// and errors become objects in the form {"error":"message"}.
+// Unlike MarshalJSON this representation is lossy and cannot be converted back to a Value.
+func (v Value) NaturalJSON() ([]byte, error) {
+	return json.Marshal(v.natural())
+}
+
+func (v Value) natural() interface{} {
+	if v.null {
+		return nil
+	}
+	switch v.typ {
+	default:
+		return nil
+	case '+', '$':
+		return string(v.str)
+	case '-':
+		return map[string]string{"error": string(v.str)}
+	case ':':
+		return v.integer
+	case '*':
+		vals := make([]interface{}, len(v.array))
+		for i := 0; i < len(v.array); i++ {
+			vals[i] = v.array[i].natural()
+		}
+		return vals
+	}
+}
@@ -0,0 +1,70 @@
+package resp
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	var tests = []struct {
+		v    Value
+		json string
+	}{
+		{SimpleStringValue("OK"), `{"type":"SimpleString","value":"OK"}`},
+		{ErrorValue(errors.New("ERR bad")), `{"type":"Error","value":"ERR bad"}`},
+		{IntegerValue(-3), `{"type":"Integer","value":-3}`},
+		{StringValue(""), `{"type":"BulkString","value":""}`},
+		{StringValue("foo"), `{"type":"BulkString","value":"foo"}`},
+		{BytesValue([]byte{0xff, 0xfe}), `{"type":"BulkString","base64":"//4="}`},
+		{NullValue(), `{"type":"BulkString","null":true}`},
+		{Value{typ: '*', null: true}, `{"type":"Array","null":true}`},
+		{ArrayValue(nil), `{"type":"Array","value":[]}`},
+		{ArrayValue([]Value{IntegerValue(1), ArrayValue([]Value{StringValue("a")})}),
+			`{"type":"Array","value":[{"type":"Integer","value":1},` +
+				`{"type":"Array","value":[{"type":"BulkString","value":"a"}]}]}`},
+	}
+	for i, test := range tests {
+		data, err := json.Marshal(test.v)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if string(data) != test.json {
+			t.Fatalf("#%d: expected '%v', got '%v'", i, test.json, string(data))
+		}
+		var v Value
+		if err := json.Unmarshal(data, &v); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if !v.Equals(test.v) || v.Type() != test.v.Type() || v.IsNull() != test.v.IsNull() {
+			t.Fatalf("#%d: expected '%v', got '%v'", i, test.v, v)
+		}
+	}
+	if _, err := json.Marshal(Value{}); err == nil {
+		t.Fatal("expected error")
+	}
+	for _, s := range []string{
+		`{"type":"Unknown"}`, `{"type":"Integer","null":true}`,
+		`{"type":"Integer","value":"1"}`, `{"type":"Array"}`, `[]`,
+	} {
+		var v Value
+		if err := json.Unmarshal([]byte(s), &v); err == nil {
+			t.Fatalf("expected error for '%v'", s)
+		}
+	}
+}
+
+func TestNaturalJSON(t *testing.T) {
+	v := ArrayValue([]Value{
+		SimpleStringValue("OK"), StringValue("foo"), IntegerValue(1), NullValue(),
+		ErrorValue(errors.New("ERR bad")), ArrayValue(nil),
+	})
+	data, err := v.NaturalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `["OK","foo",1,null,{"error":"ERR bad"},[]]`
+	if string(data) != exp {
+		t.Fatalf("expected '%v', got '%v'", exp, string(data))
+	}
+}
@@ -0,0 +1,364 @@
+package resp
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Handler handles a command. The args are the command name followed by its arguments.
+// Returning false will close the connection.
+type Handler interface {
+	ServeRESP(conn *Conn, args []Value) bool
+}
+
+// HandlerFunc is a function that handles a command. The args are the command name followed by its arguments.
+// Returning false will close the connection.
+type HandlerFunc func(conn *Conn, args []Value) bool
+
+// ServeRESP calls f(conn, args).
+func (f HandlerFunc) ServeRESP(conn *Conn, args []Value) bool {
+	return f(conn, args)
+}
+
+// Middleware wraps a HandlerFunc, allowing for code to run before and after the next handler, or to
+// not call the next handler at all. Common uses are authentication checks, metrics, and logging.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// handlerEntry is a registered handler and its middleware chain.
+type handlerEntry struct {
+	handler HandlerFunc
+	mws     []Middleware // middleware of the group
+	chain   HandlerFunc  // the handler wrapped by the group and mux middleware
+	subs    *subcommands // set when the command has subcommands
+	cmd     *Command     // set when the command was registered with HandleCommand
+}
+
+func (e *handlerEntry) build(mws []Middleware) {
+	h := e.handler
+	for i := len(e.mws) - 1; i >= 0; i-- {
+		h = e.mws[i](h)
+	}
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	e.chain = h
+}
+
+// mountEntry is a mounted ServeMux and the middleware chain that dispatches to it.
+type mountEntry struct {
+	mux *ServeMux
+	handlerEntry
+}
+
+// ServeMux is a command router. It matches the name of each command, case-insensitively,
+// against the registered commands and calls the matching handler. Commands that do not match
+// are sent an unknown command error.
+//
+// A ServeMux is a Handler, so it can be shared by several servers, registered as the handler
+// of a command in another ServeMux, or called directly from tests.
+type ServeMux struct {
+	mu       sync.RWMutex
+	handlers map[string]*handlerEntry
+	mounts   []*mountEntry
+	mws      []Middleware
+	notFound *handlerEntry
+	fallback *ServeMux // serves the commands and subcommands that are not found
+}
+
+// NewServeMux returns a new ServeMux.
+func NewServeMux() *ServeMux {
+	return newServeMux(nil)
+}
+
+// newServeMux returns a ServeMux that passes the commands which it does not handle to the fallback.
+// Subcommands that are not found are looked up in the same command of the fallback too.
+func newServeMux(fallback *ServeMux) *ServeMux {
+	notFound := HandlerFunc(unknownCommand)
+	if fallback != nil {
+		notFound = fallback.ServeRESP
+	}
+	mux := &ServeMux{
+		handlers: make(map[string]*handlerEntry),
+		notFound: &handlerEntry{handler: notFound},
+		fallback: fallback,
+	}
+	mux.notFound.build(nil)
+	return mux
+}
+
+// Handle registers the handler for the given command, replacing any existing handler.
+func (mux *ServeMux) Handle(command string, handler Handler) {
+	mux.handle(command, handler.ServeRESP, nil, nil)
+}
+
+// HandleFunc registers the handler function for the given command, replacing any existing handler.
+func (mux *ServeMux) HandleFunc(command string, handler func(conn *Conn, args []Value) bool) {
+	mux.handle(command, handler, nil, nil)
+}
+
+// HandleCommand registers the handler function for the command that is described by cmd, replacing any
+// existing handler. Calls with the wrong number of arguments are sent an error without calling the handler.
+// A subcommand is registered with a name such as "config|get", like HandleSubFunc.
+func (mux *ServeMux) HandleCommand(cmd Command, handler func(conn *Conn, args []Value) bool) {
+	mux.handleCommand(cmd, handler, nil)
+}
+
+func (mux *ServeMux) handleCommand(cmd Command, handler HandlerFunc, mws []Middleware) {
+	cmd.Name = strings.ToLower(cmd.Name)
+	cmd.Subcommands = nil
+	if cmd.Arity != 0 {
+		next := handler
+		handler = func(conn *Conn, args []Value) bool {
+			if !cmd.checkArity(len(args)) {
+				conn.WriteError(ErrWrongNumberOfArgs(cmd.Name))
+				return true
+			}
+			return next(conn, args)
+		}
+	}
+	if i := strings.IndexByte(cmd.Name, '|'); i >= 0 {
+		mux.handleSub(cmd.Name[:i], cmd.Name[i+1:], handler, mws, &cmd)
+	} else {
+		mux.handle(cmd.Name, handler, mws, &cmd)
+	}
+}
+
+func (mux *ServeMux) handle(command string, handler HandlerFunc, mws []Middleware, cmd *Command) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	e := &handlerEntry{handler: handler, mws: mws, cmd: cmd}
+	e.build(mux.mws)
+	mux.handlers[strings.ToUpper(command)] = e
+}
+
+// HandleSubFunc registers the handler function for a subcommand, such as CONFIG GET, which is a command
+// whose first argument selects the handler. The args of the handler are the full command, including the
+// command and subcommand names. Unknown subcommands are sent an error, and a HELP subcommand that lists
+// the registered subcommands is provided unless a handler for HELP is registered.
+// An empty subcommand registers the handler for calls of the command without any arguments.
+// Registering a handler for the command with HandleFunc replaces all of its subcommands.
+func (mux *ServeMux) HandleSubFunc(command, subcommand string, handler func(conn *Conn, args []Value) bool) {
+	mux.handleSub(command, subcommand, handler, nil, nil)
+}
+
+func (mux *ServeMux) handleSub(command, subcommand string, handler HandlerFunc, mws []Middleware, cmd *Command) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	commandName := strings.ToUpper(command)
+	e := mux.handlers[commandName]
+	if e == nil || e.subs == nil {
+		sc := &subcommands{mux: mux, command: commandName, handlers: make(map[string]*handlerEntry)}
+		e = &handlerEntry{handler: sc.serve, subs: sc}
+		e.build(mux.mws)
+		mux.handlers[commandName] = e
+	}
+	se := &handlerEntry{handler: handler, mws: mws, cmd: cmd}
+	se.build(nil)
+	e.subs.handlers[strings.ToUpper(subcommand)] = se
+}
+
+// subcommands dispatches a command to the handler of its subcommand.
+type subcommands struct {
+	mux      *ServeMux // guards the handlers
+	command  string
+	handlers map[string]*handlerEntry
+}
+
+func (sc *subcommands) serve(conn *Conn, args []Value) bool {
+	var subcommandName string
+	if len(args) > 1 {
+		subcommandName = strings.ToUpper(args[1].String())
+	}
+	e := sc.lookup(subcommandName)
+	var names []string
+	if e == nil && subcommandName == "HELP" {
+		seen := make(map[string]bool)
+		sc.names(seen)
+		for name := range seen {
+			names = append(names, name)
+		}
+	}
+	switch {
+	case e != nil:
+		return e.chain(conn, args)
+	case len(args) < 2:
+		conn.WriteError(ErrWrongNumberOfArgs(sc.command))
+	case subcommandName == "HELP" && len(args) == 2:
+		names = append(names, "HELP")
+		sort.Strings(names)
+		conn.WriteArrayHeader(len(names) + 2)
+		conn.WriteSimpleString(sc.command + " <subcommand> [<arg> [value] [opt] ...]. Subcommands are:")
+		for _, name := range names {
+			conn.WriteSimpleString(name)
+			if name == "HELP" {
+				conn.WriteSimpleString("    Print this help.")
+			}
+		}
+	default:
+		conn.WriteError(ErrUnknownSubcommand(sc.command, args[1].String()))
+	}
+	return true
+}
+
+// lookup returns the entry of the uppercase subcommand name, or the entry of the same subcommand in
+// the fallback of the mux. Returns nil when the subcommand is not found.
+func (sc *subcommands) lookup(subcommandName string) *handlerEntry {
+	sc.mux.mu.RLock()
+	e := sc.handlers[subcommandName]
+	sc.mux.mu.RUnlock()
+	if e == nil {
+		if fsc := sc.mux.fallback.subcommands(sc.command); fsc != nil {
+			return fsc.lookup(subcommandName)
+		}
+	}
+	return e
+}
+
+// names adds the names of the subcommands, including those of the fallback.
+func (sc *subcommands) names(names map[string]bool) {
+	sc.mux.mu.RLock()
+	for name := range sc.handlers {
+		if name != "" {
+			names[name] = true
+		}
+	}
+	sc.mux.mu.RUnlock()
+	if fsc := sc.mux.fallback.subcommands(sc.command); fsc != nil {
+		fsc.names(names)
+	}
+}
+
+// subcommands returns the subcommands of the uppercase command name, or nil.
+func (mux *ServeMux) subcommands(commandName string) *subcommands {
+	if mux == nil {
+		return nil
+	}
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	if e := mux.handlers[commandName]; e != nil {
+		return e.subs
+	}
+	return nil
+}
+
+// Use appends middleware to the ServeMux. The middleware wraps every command handler, including
+// the handlers of mounted muxes and the reply to unknown commands. The first middleware is the outermost.
+func (mux *ServeMux) Use(mws ...Middleware) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	mux.mws = append(mux.mws, mws...)
+	for _, e := range mux.handlers {
+		e.build(mux.mws)
+	}
+	for _, m := range mux.mounts {
+		m.build(mux.mws)
+	}
+	mux.notFound.build(mux.mws)
+}
+
+// Mount adds the commands of another ServeMux. Commands are matched against the handlers of this
+// ServeMux first, followed by the mounted muxes in the order they were mounted. The middleware of
+// this ServeMux runs before the middleware of the mounted mux. Commands that are registered with the
+// mounted mux later on are also served. A ServeMux must not be mounted into itself.
+func (mux *ServeMux) Mount(m *ServeMux) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	e := &mountEntry{mux: m, handlerEntry: handlerEntry{handler: m.ServeRESP}}
+	e.build(mux.mws)
+	mux.mounts = append(mux.mounts, e)
+}
+
+// Match reports whether the command is handled by the ServeMux or by one of its mounted muxes.
+func (mux *ServeMux) Match(command string) bool {
+	return mux.match(strings.ToUpper(command))
+}
+
+func (mux *ServeMux) match(commandName string) bool {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	if mux.handlers[commandName] != nil {
+		return true
+	}
+	for _, m := range mux.mounts {
+		if m.mux.match(commandName) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the middleware chain for the uppercase command name.
+func (mux *ServeMux) lookup(commandName string) HandlerFunc {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	if e := mux.handlers[commandName]; e != nil {
+		return e.chain
+	}
+	for _, m := range mux.mounts {
+		if m.mux.match(commandName) {
+			return m.chain
+		}
+	}
+	return mux.notFound.chain
+}
+
+// Commands returns the description of the commands that are handled by the ServeMux and its mounted
+// muxes, ordered by name. Commands that were registered without a Command are described by their name alone.
+func (mux *ServeMux) Commands() []Command {
+	cmds := mux.commands(nil, make(map[string]bool))
+	sortCommands(cmds)
+	return cmds
+}
+
+func (mux *ServeMux) commands(cmds []Command, seen map[string]bool) []Command {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	for name, e := range mux.handlers {
+		if !seen[name] {
+			seen[name] = true
+			cmds = append(cmds, e.command(name))
+		}
+	}
+	for _, m := range mux.mounts {
+		cmds = m.mux.commands(cmds, seen)
+	}
+	return cmds
+}
+
+// ServeRESP dispatches the command to the handler that matches its name.
+func (mux *ServeMux) ServeRESP(conn *Conn, args []Value) bool {
+	return mux.lookup(strings.ToUpper(args[0].String()))(conn, args)
+}
+
+// Group is a group of commands that share middleware.
+type Group struct {
+	mux *ServeMux
+	mws []Middleware
+}
+
+// Group returns a new command group with the middleware. The middleware only wraps the handlers that
+// are registered with the group, and runs after the middleware of the ServeMux.
+func (mux *ServeMux) Group(mws ...Middleware) *Group {
+	return &Group{mux: mux, mws: mws}
+}
+
+// Handle registers the handler for the given command in the group.
+func (g *Group) Handle(command string, handler Handler) {
+	g.mux.handle(command, handler.ServeRESP, g.mws, nil)
+}
+
+// HandleFunc registers the handler function for the given command in the group.
+func (g *Group) HandleFunc(command string, handler func(conn *Conn, args []Value) bool) {
+	g.mux.handle(command, handler, g.mws, nil)
+}
+
+// HandleSubFunc registers the handler function for a subcommand in the group. See ServeMux.HandleSubFunc.
+func (g *Group) HandleSubFunc(command, subcommand string, handler func(conn *Conn, args []Value) bool) {
+	g.mux.handleSub(command, subcommand, handler, g.mws, nil)
+}
+
+// HandleCommand registers the handler function for a command in the group. See ServeMux.HandleCommand.
+func (g *Group) HandleCommand(cmd Command, handler func(conn *Conn, args []Value) bool) {
+	g.mux.handleCommand(cmd, handler, g.mws)
+}
@@ -0,0 +1,172 @@
+package resp
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+// serveMux runs the command against the handler without a Server and returns the reply.
+func serveMux(t *testing.T, h Handler, args ...string) (Value, bool) {
+	t.Helper()
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	var values []Value
+	for _, arg := range args {
+		values = append(values, StringValue(arg))
+	}
+	keep := make(chan bool, 1)
+	go func() {
+		keep <- h.ServeRESP(NewConn(c2), values)
+	}()
+	v, _, err := NewConn(c1).ReadValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v, <-keep
+}
+
+func TestServeMux(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("echo", func(conn *Conn, args []Value) bool {
+		conn.WriteValue(args[1])
+		return true
+	})
+	mux.Handle("QUIT", HandlerFunc(quitCommand))
+	if v, keep := serveMux(t, mux, "ECHO", "hello"); v.String() != "hello" || !keep {
+		t.Fatalf("expected 'hello' true, got '%v' %v", v, keep)
+	}
+	if v, keep := serveMux(t, mux, "quit"); v.String() != "OK" || keep {
+		t.Fatalf("expected 'OK' false, got '%v' %v", v, keep)
+	}
+	if v, _ := serveMux(t, mux, "PING"); v.String() != "ERR unknown command 'PING'" {
+		t.Fatalf("expected unknown command, got '%v'", v)
+	}
+	if !mux.Match("Echo") || mux.Match("PING") {
+		t.Fatal("unexpected match")
+	}
+}
+
+func TestServeMuxMount(t *testing.T) {
+	var calls []string
+	logger := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(conn *Conn, args []Value) bool {
+				calls = append(calls, name+":"+strings.ToLower(args[0].String()))
+				return next(conn, args)
+			}
+		}
+	}
+	reply := func(s string) HandlerFunc {
+		return func(conn *Conn, args []Value) bool {
+			conn.WriteString(s)
+			return true
+		}
+	}
+	json := NewServeMux()
+	json.Use(logger("json"))
+	json.HandleFunc("json.get", reply("json"))
+	json.HandleFunc("get", reply("shadowed"))
+
+	mux := NewServeMux()
+	mux.HandleFunc("get", reply("get"))
+	mux.Mount(json)
+	mux.Use(logger("mux"))
+	// registered after mounting
+	json.HandleFunc("json.set", reply("set"))
+
+	for _, test := range []struct{ cmd, reply, calls string }{
+		{"GET", "get", "mux:get"},
+		{"JSON.GET", "json", "mux:json.get json:json.get"},
+		{"JSON.SET", "set", "mux:json.set json:json.set"},
+		{"JSON.DEL", "ERR unknown command 'JSON.DEL'", "mux:json.del"},
+	} {
+		calls = nil
+		if v, _ := serveMux(t, mux, test.cmd); v.String() != test.reply {
+			t.Fatalf("%s: expected '%v', got '%v'", test.cmd, test.reply, v)
+		}
+		if strings.Join(calls, " ") != test.calls {
+			t.Fatalf("%s: expected '%v', got '%v'", test.cmd, test.calls, calls)
+		}
+	}
+}
+
+func TestServerSharedMux(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("ping", func(conn *Conn, args []Value) bool {
+		conn.WriteSimpleString("SHARED")
+		return true
+	})
+	mux.HandleFunc("hello", func(conn *Conn, args []Value) bool {
+		conn.WriteSimpleString("WORLD")
+		return true
+	})
+	for i := 0; i < 2; i++ {
+		s, dial := testClientServer(t)
+		s.Mount(mux)
+		conn := dial()
+		for _, test := range [][2]string{
+			{"HELLO", "WORLD"}, {"PING", "SHARED"}, {"CLIENT", "ERR wrong number of arguments for 'client' command"},
+		} {
+			if v := do(t, conn, test[0]); v.String() != test[1] {
+				t.Fatalf("expected '%v', got '%v'", test[1], v)
+			}
+		}
+	}
+}
+
+func TestServeMuxSubcommands(t *testing.T) {
+	reply := func(s string) HandlerFunc {
+		return func(conn *Conn, args []Value) bool {
+			conn.WriteString(s + " " + args[len(args)-1].String())
+			return true
+		}
+	}
+	var calls int
+	counter := func(next HandlerFunc) HandlerFunc {
+		return func(conn *Conn, args []Value) bool {
+			calls++
+			return next(conn, args)
+		}
+	}
+	mux := NewServeMux()
+	mux.HandleSubFunc("config", "get", reply("get"))
+	mux.Group(counter).HandleSubFunc("CONFIG", "Set", reply("set"))
+	mux.HandleSubFunc("object", "encoding", reply("encoding"))
+	mux.HandleFunc("object", reply("object"))
+
+	for _, test := range []struct {
+		args  []string
+		reply string
+		calls int
+	}{
+		{[]string{"CONFIG", "GET", "port"}, "get port", 0},
+		{[]string{"config", "set", "port"}, "set port", 1},
+		{[]string{"CONFIG", "foo"}, "ERR unknown subcommand 'foo'. Try CONFIG HELP.", 0},
+		{[]string{"config"}, "ERR wrong number of arguments for 'config' command", 0},
+		{[]string{"CONFIG", "HELP", "extra"}, "ERR unknown subcommand 'HELP'. Try CONFIG HELP.", 0},
+		{[]string{"OBJECT", "ENCODING", "key"}, "object key", 0},
+	} {
+		calls = 0
+		if v, _ := serveMux(t, mux, test.args...); v.String() != test.reply {
+			t.Fatalf("%v: expected '%v', got '%v'", test.args, test.reply, v)
+		}
+		if calls != test.calls {
+			t.Fatalf("%v: expected %v, got %v", test.args, test.calls, calls)
+		}
+	}
+	v, _ := serveMux(t, mux, "config", "help")
+	var lines []string
+	for _, line := range v.Array() {
+		lines = append(lines, line.String())
+	}
+	help := "CONFIG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:|GET|HELP|    Print this help.|SET"
+	if strings.Join(lines, "|") != help {
+		t.Fatalf("expected '%v', got '%v'", help, strings.Join(lines, "|"))
+	}
+	mux.HandleSubFunc("config", "help", reply("custom"))
+	if v, _ := serveMux(t, mux, "CONFIG", "HELP"); v.String() != "custom HELP" {
+		t.Fatalf("expected 'custom HELP', got '%v'", v)
+	}
+}
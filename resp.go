@@ -11,6 +11,11 @@ import (
 
 const bufsz = 4096
 
+const (
+	maxBulkLen  = 512 * 1024 * 1024 // largest bulk string allowed by Redis
+	maxArrayLen = 1024 * 1024       // largest multibulk allowed by Redis
+)
+
 // Type represents a Value type
 type Type byte
 
@@ -108,10 +113,11 @@ func (v Value) Bool() bool {
 }
 
 // Error converts the Value to an error. If Value is not an error, nil is returned.
+// The returned error is a *RedisError.
 func (v Value) Error() error {
 	switch v.typ {
 	case '-':
-		return errors.New(string(v.str))
+		return &RedisError{msg: string(v.str)}
 	}
 	return nil
 }
@@ -124,6 +130,55 @@ func (v Value) Array() []Value {
 	return nil
 }
 
+// Index returns the element at index i of an array. If Value is not an array or i is out of range, a RESP Null value is returned.
+func (v Value) Index(i int) Value {
+	arr := v.Array()
+	if i < 0 || i >= len(arr) {
+		return NullValue()
+	}
+	return arr[i]
+}
+
+// Get returns the value of a field in a map. RESP does not have a map type so maps are arrays of
+// alternating fields and values, such as the replies to HGETALL, CONFIG GET, or XINFO.
+// If Value is not an array or the field does not exist, a RESP Null value is returned.
+func (v Value) Get(field string) Value {
+	arr := v.Array()
+	for i := 0; i+1 < len(arr); i += 2 {
+		switch arr[i].typ {
+		case '$', '+':
+			if string(arr[i].str) == field {
+				return arr[i+1]
+			}
+		case ':':
+			if arr[i].String() == field {
+				return arr[i+1]
+			}
+		}
+	}
+	return NullValue()
+}
+
+// Walk calls iter for Value and every nested value in depth-first order.
+// The path contains the array indexes leading to the value and is empty for Value itself.
+// The path is reused between calls and must be copied if it's retained.
+// Returning false from iter stops the walk.
+func (v Value) Walk(iter func(path []int, v Value) bool) {
+	v.walk(nil, iter)
+}
+
+func (v Value) walk(path []int, iter func(path []int, v Value) bool) bool {
+	if !iter(path, v) {
+		return false
+	}
+	for i, elem := range v.Array() {
+		if !elem.walk(append(path, i), iter) {
+			return false
+		}
+	}
+	return true
+}
+
 // Type returns the underlying RESP type. The following types are represent valid RESP values.
 //
 //	'+'  SimpleString
@@ -135,71 +190,222 @@ func (v Value) Type() Type {
 	return v.typ
 }
 
-func marshalSimpleRESP(typ Type, b []byte) ([]byte, error) {
-	bb := make([]byte, 3+len(b))
-	bb[0] = byte(typ)
-	copy(bb[1:], b)
-	bb[1+len(b)+0] = '\r'
-	bb[1+len(b)+1] = '\n'
-	return bb, nil
-}
-
-func marshalBulkRESP(v Value) ([]byte, error) {
-	if v.null {
-		return []byte("$-1\r\n"), nil
-	}
-	szb := []byte(strconv.FormatInt(int64(len(v.str)), 10))
-	bb := make([]byte, 5+len(szb)+len(v.str))
-	bb[0] = '$'
-	copy(bb[1:], szb)
-	bb[1+len(szb)+0] = '\r'
-	bb[1+len(szb)+1] = '\n'
-	copy(bb[1+len(szb)+2:], v.str)
-	bb[1+len(szb)+2+len(v.str)+0] = '\r'
-	bb[1+len(szb)+2+len(v.str)+1] = '\n'
-	return bb, nil
-}
-
-func marshalArrayRESP(v Value) ([]byte, error) {
-	if v.null {
-		return []byte("*-1\r\n"), nil
-	}
-	szb := []byte(strconv.FormatInt(int64(len(v.array)), 10))
-
-	var buf bytes.Buffer
-	buf.Grow(3 + len(szb) + 16*len(v.array)) // prime the buffer
-	buf.WriteByte('*')
-	buf.Write(szb)
-	buf.WriteByte('\r')
-	buf.WriteByte('\n')
-	for i := 0; i < len(v.array); i++ {
-		data, err := v.array[i].MarshalRESP()
-		if err != nil {
-			return nil, err
+// AppendValue appends the RESP serialized representation of v to dst and
+// returns the extended buffer. Values of an unknown type are appended as a
+// RESP Null bulk string.
+func AppendValue(dst []byte, v Value) []byte {
+	dst, _ = appendAnyRESP(dst, v)
+	return dst
+}
+
+// AppendSimpleString appends a RESP simple string to dst. A simple string has no new lines. The carriage return and new line characters are replaced with spaces.
+func AppendSimpleString(dst []byte, s string) []byte {
+	dst = append(dst, '+')
+	return appendSingleLine(dst, s)
+}
+
+// AppendError appends a RESP error to dst. The carriage return and new line characters are replaced with spaces.
+func AppendError(dst []byte, msg string) []byte {
+	dst = append(dst, '-')
+	return appendSingleLine(dst, msg)
+}
+
+// AppendInt appends a RESP integer to dst.
+func AppendInt(dst []byte, n int) []byte {
+	dst = append(dst, ':')
+	dst = strconv.AppendInt(dst, int64(n), 10)
+	return append(dst, '\r', '\n')
+}
+
+// AppendBulk appends a RESP bulk string to dst. A bulk string can represent any data.
+func AppendBulk(dst []byte, b []byte) []byte {
+	dst = append(dst, '$')
+	dst = strconv.AppendInt(dst, int64(len(b)), 10)
+	dst = append(dst, '\r', '\n')
+	dst = append(dst, b...)
+	return append(dst, '\r', '\n')
+}
+
+// AppendBulkString appends a RESP bulk string to dst. A bulk string can represent any data.
+func AppendBulkString(dst []byte, s string) []byte {
+	dst = append(dst, '$')
+	dst = strconv.AppendInt(dst, int64(len(s)), 10)
+	dst = append(dst, '\r', '\n')
+	dst = append(dst, s...)
+	return append(dst, '\r', '\n')
+}
+
+// AppendNull appends a RESP null bulk string to dst.
+func AppendNull(dst []byte) []byte {
+	return append(dst, "$-1\r\n"...)
+}
+
+// AppendArrayHeader appends the header of a RESP array with n elements to dst.
+// The caller is expected to append exactly n values following the header.
+func AppendArrayHeader(dst []byte, n int) []byte {
+	dst = append(dst, '*')
+	dst = strconv.AppendInt(dst, int64(n), 10)
+	return append(dst, '\r', '\n')
+}
+
+// AppendNullArray appends a RESP null array to dst.
+func AppendNullArray(dst []byte) []byte {
+	return append(dst, "*-1\r\n"...)
+}
+
+func appendSingleLine(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' {
+			dst = append(dst, ' ')
+		} else {
+			dst = append(dst, s[i])
+		}
+	}
+	return append(dst, '\r', '\n')
+}
+
+func appendSimpleRESP(dst []byte, typ Type, b []byte) []byte {
+	dst = append(dst, byte(typ))
+	dst = append(dst, b...)
+	return append(dst, '\r', '\n')
+}
+
+var errUnknownType = errors.New("unknown resp type encountered")
+
+// appendAnyRESP appends the serialized v to dst. Unknown types are written
+// as a null bulk string, and errUnknownType is returned alongside.
+func appendAnyRESP(dst []byte, v Value) ([]byte, error) {
+	switch v.typ {
+	default:
+		if v.typ == 0 && v.null {
+			return AppendNull(dst), nil
+		}
+		return AppendNull(dst), errUnknownType
+	case '-', '+':
+		return appendSimpleRESP(dst, v.typ, v.str), nil
+	case ':':
+		return AppendInt(dst, v.integer), nil
+	case '$':
+		if v.null {
+			return AppendNull(dst), nil
 		}
-		buf.Write(data)
+		return AppendBulk(dst, v.str), nil
+	case '*':
+		if v.null {
+			return AppendNullArray(dst), nil
+		}
+		dst = AppendArrayHeader(dst, len(v.array))
+		var err error
+		for i := 0; i < len(v.array); i++ {
+			var verr error
+			dst, verr = appendAnyRESP(dst, v.array[i])
+			if verr != nil && err == nil {
+				err = verr
+			}
+		}
+		return dst, err
 	}
-	return buf.Bytes(), nil
 }
 
 func marshalAnyRESP(v Value) ([]byte, error) {
+	b, err := appendAnyRESP(nil, v)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+var (
+	errInvalidSimpleString = errors.New("simple string contains CR or LF")
+	errInvalidErrorString  = errors.New("error string contains CR or LF")
+	errInvalidBulkLength   = errors.New("invalid bulk length")
+	errInvalidArrayLength  = errors.New("invalid array length")
+)
+
+// Validate checks that Value, and all of its nested values, can be serialized and read back by
+// a RESP reader such as Redis. An error is returned for values of an unknown type, simple strings
+// and errors containing carriage returns or new lines, bulk strings larger than 512 MB, and arrays
+// with more than 1048576 elements.
+func (v Value) Validate() error {
+	return v.validate(maxBulkLen, maxArrayLen)
+}
+
+// validate checks the value against the bulk string and array length limits.
+func (v Value) validate(maxBulk, maxArray int) error {
 	switch v.typ {
 	default:
 		if v.typ == 0 && v.null {
-			return []byte("$-1\r\n"), nil
+			return nil
+		}
+		return errUnknownType
+	case '+':
+		if bytes.ContainsAny(v.str, "\r\n") {
+			return errInvalidSimpleString
+		}
+	case '-':
+		if bytes.ContainsAny(v.str, "\r\n") {
+			return errInvalidErrorString
+		}
+	case ':':
+	case '$':
+		if len(v.str) > maxBulk {
+			return errInvalidBulkLength
 		}
-		return nil, errors.New("unknown resp type encountered")
+	case '*':
+		if len(v.array) > maxArray {
+			return errInvalidArrayLength
+		}
+		for i := 0; i < len(v.array); i++ {
+			if err := v.array[i].validate(maxBulk, maxArray); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// EncodedLen returns the exact number of bytes of the serialized representation of Value,
+// without serializing it. It's the length of the data that AppendValue appends.
+func (v Value) EncodedLen() int {
+	switch v.typ {
+	default:
+		return 5 // $-1\r\n
 	case '-', '+':
-		return marshalSimpleRESP(v.typ, v.str)
+		return 3 + len(v.str)
 	case ':':
-		return marshalSimpleRESP(v.typ, []byte(strconv.FormatInt(int64(v.integer), 10)))
+		return 3 + intLen(v.integer)
 	case '$':
-		return marshalBulkRESP(v)
+		if v.null {
+			return 5
+		}
+		return 5 + intLen(len(v.str)) + len(v.str)
 	case '*':
-		return marshalArrayRESP(v)
+		if v.null {
+			return 5
+		}
+		n := 3 + intLen(len(v.array))
+		for i := 0; i < len(v.array); i++ {
+			n += v.array[i].EncodedLen()
+		}
+		return n
 	}
 }
 
+// intLen returns the number of characters of the base 10 representation of n.
+func intLen(n int) int {
+	l := 1
+	u := uint64(n)
+	if n < 0 {
+		l++
+		u = uint64(-(n + 1)) + 1
+	}
+	for u >= 10 {
+		u /= 10
+		l++
+	}
+	return l
+}
+
 // Equals compares one value to another value.
 func (v Value) Equals(value Value) bool {
 	data1, err := v.MarshalRESP()
@@ -229,7 +435,9 @@ func (err errProtocol) Error() string {
 
 // Reader is a specialized RESP Value type reader.
 type Reader struct {
-	rd *bufio.Reader
+	rd      *bufio.Reader
+	lenient bool
+	relaxed bool
 }
 
 // NewReader returns a Reader for reading Value types.
@@ -238,12 +446,29 @@ func NewReader(rd io.Reader) *Reader {
 	return r
 }
 
+// SetLenient sets the lenient mode of the Reader. By default the Reader is strict and only
+// accepts the exact format that Redis accepts. In lenient mode the Reader also accepts lines
+// that end with a new line without a carriage return, trailing spaces and tabs after integers
+// and lengths, and integers and lengths with a leading '+' sign.
+// This is useful for reading RESP that was written by hand or generated by scripts.
+func (rd *Reader) SetLenient(lenient bool) {
+	rd.lenient = lenient
+}
+
 // ReadValue reads the next Value from Reader.
 func (rd *Reader) ReadValue() (value Value, n int, err error) {
 	value, _, n, err = rd.readValue(false, false)
 	return
 }
 
+// SetRelaxedMultiBulk sets the relaxed multi bulk mode of the Reader. By default ReadMultiBulk
+// only accepts arrays of bulk strings. In relaxed mode the elements may be of any RESP type,
+// including integers and nested arrays, which are returned as is. This is how ReadMultiBulk behaved
+// before it was limited to bulk strings.
+func (rd *Reader) SetRelaxedMultiBulk(relaxed bool) {
+	rd.relaxed = relaxed
+}
+
 // ReadMultiBulk reads the next multi bulk Value from Reader.
 // A multi bulk value is a RESP array that contains one or more bulk strings.
 // For more information on RESP arrays and strings please see http://redis.io/topics/protocol.
@@ -259,6 +484,9 @@ func (rd *Reader) readValue(multibulk, child bool) (val Value, telnet bool, n in
 		return nullValue, false, n, err
 	}
 	n++
+	if multibulk && child && c != '$' {
+		return nullValue, telnet, n, &errProtocol{"expected '$', got '" + string(c) + "'"}
+	}
 	if c == '*' {
 		val, rn, err = rd.readArrayValue(multibulk)
 	} else if multibulk && !child {
@@ -266,9 +494,6 @@ func (rd *Reader) readValue(multibulk, child bool) (val Value, telnet bool, n in
 	} else {
 		switch c {
 		default:
-			if multibulk && child {
-				return nullValue, telnet, n, &errProtocol{"expected '$', got '" + string(c) + "'"}
-			}
 			if child {
 				return nullValue, telnet, n, &errProtocol{"unknown first byte"}
 			}
@@ -354,6 +579,18 @@ func (rd *Reader) readSimpleValue(typ byte) (val Value, n int, err error) {
 	return Value{typ: Type(typ), str: line}, n, nil
 }
 func (rd *Reader) readLine() (line []byte, n int, err error) {
+	if rd.lenient {
+		line, err = rd.rd.ReadBytes('\n')
+		if err != nil {
+			return nil, 0, err
+		}
+		n = len(line)
+		line = line[:len(line)-1]
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+		return line, n, nil
+	}
 	for {
 		b, err := rd.rd.ReadBytes('\n')
 		if err != nil {
@@ -381,15 +618,31 @@ func (rd *Reader) readBulkValue() (val Value, n int, err error) {
 	if l < 0 {
 		return Value{typ: '$', null: true}, n, nil
 	}
-	if l > 512*1024*1024 {
+	if l > maxBulkLen {
 		return nullValue, n, &errProtocol{"invalid bulk length"}
 	}
 	b := make([]byte, l+2)
+	if rd.lenient {
+		// read the data and the first byte of the line ending
+		b = b[:l+1]
+	}
 	rn, err = io.ReadFull(rd.rd, b)
 	n += rn
 	if err != nil {
 		return nullValue, n, err
 	}
+	if rd.lenient && b[l] == '\r' {
+		var c byte
+		c, err = rd.rd.ReadByte()
+		if err != nil {
+			return nullValue, n, err
+		}
+		n++
+		b = append(b, c)
+	}
+	if rd.lenient && b[l] == '\n' {
+		b = append(b[:l], '\r', '\n')
+	}
 	if b[l] != '\r' || b[l+1] != '\n' {
 		return nullValue, n, &errProtocol{"invalid bulk line ending"}
 	}
@@ -401,7 +654,10 @@ func (rd *Reader) readArrayValue(multibulk bool) (val Value, n int, err error) {
 	var l int
 	l, rn, err = rd.readInt()
 	n += rn
-	if err != nil || l > 1024*1024 {
+	if err == nil && l > maxArrayLen {
+		err = &errProtocol{"invalid length"}
+	}
+	if err != nil {
 		if _, ok := err.(*errProtocol); ok {
 			if multibulk {
 				return nullValue, n, &errProtocol{"invalid multibulk length"}
@@ -416,7 +672,7 @@ func (rd *Reader) readArrayValue(multibulk bool) (val Value, n int, err error) {
 	var aval Value
 	vals := make([]Value, l)
 	for i := 0; i < l; i++ {
-		aval, _, rn, err = rd.readValue(multibulk, true)
+		aval, _, rn, err = rd.readValue(multibulk && !rd.relaxed, true)
 		n += rn
 		if err != nil {
 			return nullValue, n, err
@@ -443,9 +699,14 @@ func (rd *Reader) readInt() (x int, n int, err error) {
 	if err != nil {
 		return 0, 0, err
 	}
+	if rd.lenient {
+		line = bytes.TrimRight(line, " \t")
+	} else if len(line) > 0 && line[0] == '+' {
+		return 0, n, &errProtocol{"invalid integer"}
+	}
 	i64, err := strconv.ParseInt(string(line), 10, 64)
 	if err != nil {
-		return 0, n, err
+		return 0, n, &errProtocol{"invalid integer"}
 	}
 	return int(i64), n, nil
 }
@@ -571,26 +832,110 @@ func MultiBulkValue(commandName string, args ...interface{}) Value {
 	return ArrayValue(vals)
 }
 
+// CommandValue returns a RESP array which contains the command name as a bulk string followed
+// by the arguments. Unlike MultiBulkValue the arguments keep their types, allowing for integers
+// and nested arrays. Such commands can only be read by a Reader in relaxed multi bulk mode.
+func CommandValue(commandName string, args ...Value) Value {
+	vals := make([]Value, len(args)+1)
+	vals[0] = StringValue(commandName)
+	copy(vals[1:], args)
+	return ArrayValue(vals)
+}
+
 // Writer is a specialized RESP Value type writer.
+//
+// A Writer returned by NewWriter issues one write to the underlying io.Writer
+// per value. A Writer returned by NewWriterSize buffers values and only
+// writes once the buffer fills up or Flush is called.
+// If an error occurs writing to the underlying io.Writer, no more data will
+// be accepted and all subsequent writes, and Flush, will return the error.
 type Writer struct {
-	wr io.Writer
+	wr     io.Writer
+	buf    []byte
+	size   int
+	err    error
+	strict bool
 }
 
 // NewWriter returns a new Writer.
 func NewWriter(wr io.Writer) *Writer {
-	return &Writer{wr}
+	return &Writer{wr: wr}
+}
+
+// NewWriterSize returns a new buffered Writer whose buffer has at least the specified size.
+// A size of zero or less uses the default size. Call Flush to write buffered values to the underlying io.Writer.
+func NewWriterSize(wr io.Writer, size int) *Writer {
+	if size <= 0 {
+		size = bufsz
+	}
+	return &Writer{wr: wr, buf: make([]byte, 0, size), size: size}
+}
+
+// SetStrict sets the strict mode of the Writer. In strict mode every value is checked with
+// Value.Validate, and aggregate headers are checked for valid lengths, before being written.
+// Malformed values are rejected with an error and nothing is written.
+func (wr *Writer) SetStrict(strict bool) {
+	wr.strict = strict
 }
 
 // WriteValue writes a RESP Value.
 func (wr *Writer) WriteValue(v Value) error {
-	b, err := v.MarshalRESP()
+	if wr.err != nil {
+		return wr.err
+	}
+	if wr.strict {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+	mark := len(wr.buf)
+	buf, err := appendAnyRESP(wr.buf, v)
+	if err != nil {
+		wr.buf = buf[:mark]
+		return err
+	}
+	wr.buf = buf
+	return wr.written()
+}
+
+// written is called after data was appended to the buffer. It flushes
+// the buffer when the Writer is unbuffered or when the buffer is full.
+func (wr *Writer) written() error {
+	if wr.size == 0 || len(wr.buf) >= wr.size {
+		return wr.Flush()
+	}
+	return nil
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (wr *Writer) Flush() error {
+	if wr.err != nil {
+		return wr.err
+	}
+	if len(wr.buf) == 0 {
+		return nil
+	}
+	n, err := wr.wr.Write(wr.buf)
+	if n < len(wr.buf) && err == nil {
+		err = io.ErrShortWrite
+	}
 	if err != nil {
+		if n > 0 && n < len(wr.buf) {
+			copy(wr.buf[0:len(wr.buf)-n], wr.buf[n:])
+		}
+		wr.buf = wr.buf[:len(wr.buf)-n]
+		wr.err = err
 		return err
 	}
-	_, err = wr.wr.Write(b)
+	wr.buf = wr.buf[:0]
 	return nil
 }
 
+// Buffered returns the number of bytes that have been written into the current buffer.
+func (wr *Writer) Buffered() int {
+	return len(wr.buf)
+}
+
 // WriteSimpleString writes a RESP simple string. A simple string has no new lines. The carriage return and new line characters are replaced with spaces.
 func (wr *Writer) WriteSimpleString(s string) error { return wr.WriteValue(SimpleStringValue(s)) }
 
@@ -612,6 +957,37 @@ func (wr *Writer) WriteInteger(i int) error { return wr.WriteValue(IntegerValue(
 // WriteArray writes a RESP array.
 func (wr *Writer) WriteArray(vals []Value) error { return wr.WriteValue(ArrayValue(vals)) }
 
+// WriteArrayHeader writes the header of a RESP array with n elements.
+// The elements must follow by calling exactly n Write methods. This allows for
+// streaming large arrays without first building a []Value.
+func (wr *Writer) WriteArrayHeader(n int) error {
+	if wr.err != nil {
+		return wr.err
+	}
+	if wr.strict && (n < 0 || n > maxArrayLen) {
+		return errInvalidArrayLength
+	}
+	wr.buf = AppendArrayHeader(wr.buf, n)
+	return wr.written()
+}
+
+// WriteMapHeader writes the header of a map with n key/value pairs.
+// RESP has no map type, so the map is written as an array of 2*n elements, which is
+// how Redis returns maps to RESP clients. The keys and values must follow, in order,
+// by calling exactly 2*n Write methods.
+func (wr *Writer) WriteMapHeader(n int) error {
+	return wr.WriteArrayHeader(n * 2)
+}
+
+// WriteNullArray writes a RESP null array.
+func (wr *Writer) WriteNullArray() error {
+	if wr.err != nil {
+		return wr.err
+	}
+	wr.buf = AppendNullArray(wr.buf)
+	return wr.written()
+}
+
 // WriteMultiBulk writes a RESP array which contains one or more bulk strings.
 // For more information on RESP arrays and strings please see http://redis.io/topics/protocol.
 func (wr *Writer) WriteMultiBulk(commandName string, args ...interface{}) error {
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 	"strings"
 	"testing"
@@ -137,6 +138,9 @@ func TestLotsaRandomness(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
+		if v.EncodedLen() != len(resp) {
+			t.Fatalf("expected encoded len %d, got %d", len(resp), v.EncodedLen())
+		}
 		if string(resp) != anys[i] {
 			t.Fatalf("resp failed to remarshal #%d\n-- original --\n%s\n-- remarshalled --\n%s\n-- done --", i, anys[i], string(resp))
 		}
@@ -155,13 +159,14 @@ func TestBigFragmented(t *testing.T) {
 		defer pw.Close()
 		for len(cmd) >= frag {
 			if _, err := pw.Write(cmd[:frag]); err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 			cmd = cmd[frag:]
 		}
 		if len(cmd) > 0 {
 			if _, err := pw.Write(cmd); err != nil {
-				t.Fatal(err)
+				t.Error(err)
 			}
 		}
 	}()
@@ -255,6 +260,101 @@ func TestTelnetReader(t *testing.T) {
 	}
 }
 
+func TestLenientReader(t *testing.T) {
+	data := "*3\n$3\nSET\n$3 \r\nkey\r\n:+12\t\n+OK\n-ERR bad\r\n$-1\n"
+	rd := NewReader(bytes.NewBufferString(data))
+	if _, _, err := rd.ReadValue(); err == nil {
+		t.Fatal("expected error")
+	}
+	rd = NewReader(bytes.NewBufferString(data))
+	rd.SetLenient(true)
+	var vals []Value
+	var n int
+	for {
+		v, rn, err := rd.ReadValue()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += rn
+		vals = append(vals, v)
+	}
+	if n != len(data) {
+		t.Fatalf("expected %v, got %v", len(data), n)
+	}
+	res := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n:12\r\n+OK\r\n-ERR bad\r\n$-1\r\n"
+	var out []byte
+	for _, v := range vals {
+		out = AppendValue(out, v)
+	}
+	if string(out) != res {
+		t.Fatalf("expected '%v', got '%v'", res, string(out))
+	}
+	rd = NewReader(bytes.NewBufferString("$3\nabcd\n"))
+	rd.SetLenient(true)
+	if _, _, err := rd.ReadValue(); err == nil || err.Error() != "Protocol error: invalid bulk line ending" {
+		t.Fatalf("expected 'Protocol error: invalid bulk line ending', got '%v'", err)
+	}
+	for _, s := range []string{":+1\r\n", "$+1\r\na\r\n", ":1 \r\n"} {
+		_, _, err := NewReader(bytes.NewBufferString(s)).ReadValue()
+		if err == nil {
+			t.Fatalf("expected error for '%v'", s)
+		}
+	}
+}
+
+func TestReadMultiBulkDefault(t *testing.T) {
+	for _, raw := range []string{
+		"*1\r\n:1\r\n",
+		"*2\r\n$3\r\nSET\r\n+OK\r\n",
+		"*2\r\n$3\r\nSET\r\n-ERR\r\n",
+		"*2\r\n$3\r\nSET\r\n*1\r\n$1\r\na\r\n",
+	} {
+		_, _, _, err := NewReader(bytes.NewBufferString(raw)).ReadMultiBulk()
+		if _, ok := err.(*errProtocol); !ok {
+			t.Fatalf("%q: expected protocol error, got '%v'", raw, err)
+		}
+		rd := NewReader(bytes.NewBufferString(raw))
+		rd.SetRelaxedMultiBulk(true)
+		if _, _, _, err := rd.ReadMultiBulk(); err != nil {
+			t.Fatalf("%q: %v", raw, err)
+		}
+	}
+	v, _, _, err := NewReader(bytes.NewBufferString("*2\r\n$3\r\nGET\r\n$1\r\na\r\n")).ReadMultiBulk()
+	if err != nil || v.String() != "[GET a]" {
+		t.Fatalf("expected '[GET a]', got '%v' %v", v, err)
+	}
+}
+
+func TestRelaxedMultiBulk(t *testing.T) {
+	cmd := CommandValue("CALL", IntegerValue(1), ArrayValue([]Value{StringValue("a"), IntegerValue(2)}))
+	data, err := cmd.MarshalRESP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, err = NewReader(bytes.NewBuffer(data)).ReadMultiBulk()
+	if err == nil || err.Error() != "Protocol error: expected '$', got ':'" {
+		t.Fatalf("expected 'Protocol error: expected '$', got ':'', got '%v'", err)
+	}
+	rd := NewReader(bytes.NewBuffer(data))
+	rd.SetRelaxedMultiBulk(true)
+	v, telnet, n, err := rd.ReadMultiBulk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if telnet || n != len(data) {
+		t.Fatalf("expected false and %v, got %v and %v", len(data), telnet, n)
+	}
+	if !v.Equals(cmd) {
+		t.Fatalf("expected '%v', got '%v'", cmd, v)
+	}
+	if v.Index(1).Type() != Integer || v.Index(2).Index(1).Type() != Integer {
+		t.Fatalf("expected typed arguments, got '%v'", v)
+	}
+}
+
 func TestWriter(t *testing.T) {
 	var buf bytes.Buffer
 	wr := NewWriter(&buf)
@@ -282,6 +382,298 @@ func TestWriter(t *testing.T) {
 
 }
 
+func TestWriterStreaming(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriterSize(&buf, 0)
+	wr.WriteArrayHeader(3)
+	wr.WriteString("HELLO")
+	wr.WriteInteger(1)
+	wr.WriteMapHeader(2)
+	wr.WriteString("a")
+	wr.WriteInteger(1)
+	wr.WriteString("b")
+	wr.WriteNullArray()
+	if err := wr.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	res := "" +
+		"*3\r\n$5\r\nHELLO\r\n:1\r\n" +
+		"*4\r\n$1\r\na\r\n:1\r\n$1\r\nb\r\n*-1\r\n"
+	if buf.String() != res {
+		t.Fatalf("expected '%v', got '%v'", res, buf.String())
+	}
+	v, _, err := NewReader(&buf).ReadValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Array()) != 3 || len(v.Array()[2].Array()) != 4 {
+		t.Fatalf("unexpected value '%v'", v)
+	}
+}
+
+func TestEncodedLen(t *testing.T) {
+	vals := []Value{
+		{}, NullValue(), {typ: '*', null: true},
+		IntegerValue(0), IntegerValue(9), IntegerValue(10), IntegerValue(-1),
+		IntegerValue(-10), IntegerValue(math.MaxInt64), IntegerValue(math.MinInt64),
+		StringValue(""), StringValue(strings.Repeat("A", 1000)),
+		SimpleStringValue("OK"), ErrorValue(errors.New("ERR bad")),
+		ArrayValue(nil), MultiBulkValue("SET", "key", 1234),
+		ArrayValue([]Value{ArrayValue([]Value{IntegerValue(1)}), NullValue()}),
+	}
+	for i, v := range vals {
+		b := AppendValue(nil, v)
+		if v.EncodedLen() != len(b) {
+			t.Fatalf("#%d: expected %d, got %d", i, len(b), v.EncodedLen())
+		}
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	v := ArrayValue([]Value{
+		StringValue("name"), StringValue("shard-1"),
+		SimpleStringValue("slots"), ArrayValue([]Value{IntegerValue(0), IntegerValue(5460)}),
+		IntegerValue(10), StringValue("ten"),
+		StringValue("odd"),
+	})
+	if v.Get("name").String() != "shard-1" {
+		t.Fatalf("expected 'shard-1', got '%v'", v.Get("name"))
+	}
+	if v.Get("slots").Index(1).Integer() != 5460 {
+		t.Fatalf("expected 5460, got '%v'", v.Get("slots").Index(1))
+	}
+	if v.Get("10").String() != "ten" {
+		t.Fatalf("expected 'ten', got '%v'", v.Get("10"))
+	}
+	if !v.Get("odd").IsNull() || !v.Get("shard-1").IsNull() {
+		t.Fatal("expected null")
+	}
+	if !v.Index(-1).IsNull() || !v.Index(7).IsNull() || !v.Index(0).Index(0).IsNull() {
+		t.Fatal("expected null")
+	}
+	if !StringValue("name").Get("name").IsNull() {
+		t.Fatal("expected null")
+	}
+	var paths []string
+	v.Walk(func(path []int, v Value) bool {
+		paths = append(paths, fmt.Sprintf("%v:%v", path, v.Type()))
+		return true
+	})
+	res := "[]:Array [0]:BulkString [1]:BulkString [2]:SimpleString [3]:Array " +
+		"[3 0]:Integer [3 1]:Integer [4]:Integer [5]:BulkString [6]:BulkString"
+	if strings.Join(paths, " ") != res {
+		t.Fatalf("expected '%v', got '%v'", res, strings.Join(paths, " "))
+	}
+	var count int
+	v.Walk(func(path []int, v Value) bool {
+		count++
+		return v.Type() != Integer
+	})
+	if count != 6 {
+		t.Fatalf("expected 6, got %v", count)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := []Value{
+		{null: true}, SimpleStringValue("OK\r\n"), ErrorValue(errors.New("ERR\nbad")),
+		IntegerValue(1), StringValue("\r\n"), NullValue(), {typ: '*', null: true},
+		MultiBulkValue("SET", "key", "value"),
+	}
+	for i, v := range valid {
+		if err := v.Validate(); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+	}
+	invalid := []struct {
+		v   Value
+		err string
+	}{
+		{Value{}, "unknown resp type encountered"},
+		{Value{typ: 'x'}, "unknown resp type encountered"},
+		{Value{typ: '+', str: []byte("OK\r\n")}, "simple string contains CR or LF"},
+		{Value{typ: '-', str: []byte("ERR\n")}, "error string contains CR or LF"},
+		{Value{typ: '$', str: make([]byte, 17)}, "invalid bulk length"},
+		{Value{typ: '*', array: make([]Value, 5)}, "invalid array length"},
+		{ArrayValue([]Value{IntegerValue(1), ArrayValue([]Value{{typ: '+', str: []byte("\r")}})}),
+			"simple string contains CR or LF"},
+	}
+	for i, test := range invalid {
+		// lowered limits, to test the lengths without huge allocations
+		if err := test.v.validate(16, 4); err == nil || err.Error() != test.err {
+			t.Fatalf("#%d: expected '%v', got '%v'", i, test.err, err)
+		}
+	}
+	// the reader rejects the lengths that Validate rejects
+	big := fmt.Sprintf("*%d\r\n", maxArrayLen+1)
+	if _, _, err := NewReader(bytes.NewBufferString(big)).ReadValue(); err == nil ||
+		err.Error() != "Protocol error: invalid array length" {
+		t.Fatalf("expected 'Protocol error: invalid array length', got '%v'", err)
+	}
+	if _, _, _, err := NewReader(bytes.NewBufferString(big)).ReadMultiBulk(); err == nil ||
+		err.Error() != "Protocol error: invalid multibulk length" {
+		t.Fatalf("expected 'Protocol error: invalid multibulk length', got '%v'", err)
+	}
+	big = fmt.Sprintf("$%d\r\n", maxBulkLen+1)
+	if _, _, err := NewReader(bytes.NewBufferString(big)).ReadValue(); err == nil ||
+		err.Error() != "Protocol error: invalid bulk length" {
+		t.Fatalf("expected 'Protocol error: invalid bulk length', got '%v'", err)
+	}
+}
+
+func TestWriterStrict(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	bad := Value{typ: '-', str: []byte("ERR\r\n")}
+	if err := wr.WriteValue(bad); err != nil {
+		t.Fatal(err)
+	}
+	wr.SetStrict(true)
+	if err := wr.WriteValue(bad); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := wr.WriteArrayHeader(maxArrayLen + 1); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := wr.WriteString("OK"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "-ERR\r\n\r\n$2\r\nOK\r\n" {
+		t.Fatalf("expected '%v', got '%v'", "-ERR\r\n\r\n$2\r\nOK\r\n", buf.String())
+	}
+}
+
+type countWriter struct {
+	buf    bytes.Buffer
+	writes int
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.buf.Write(p)
+}
+
+type failWriter struct{ n int }
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errors.New("write failed")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriterBuffered(t *testing.T) {
+	var cw countWriter
+	wr := NewWriterSize(&cw, 64)
+	for i := 0; i < 3; i++ {
+		if err := wr.WriteSimpleString("OK"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cw.writes != 0 {
+		t.Fatalf("expected 0, got %v", cw.writes)
+	}
+	if wr.Buffered() != 15 {
+		t.Fatalf("expected 15, got %v", wr.Buffered())
+	}
+	if err := wr.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if cw.writes != 1 {
+		t.Fatalf("expected 1, got %v", cw.writes)
+	}
+	if cw.buf.String() != "+OK\r\n+OK\r\n+OK\r\n" {
+		t.Fatalf("expected '%v', got '%v'", "+OK\r\n+OK\r\n+OK\r\n", cw.buf.String())
+	}
+	// filling the buffer flushes automatically
+	if err := wr.WriteString(strings.Repeat("A", 100)); err != nil {
+		t.Fatal(err)
+	}
+	if cw.writes != 2 || wr.Buffered() != 0 {
+		t.Fatalf("expected 2 and 0, got %v and %v", cw.writes, wr.Buffered())
+	}
+	// values that fail to marshal leave the buffer untouched
+	wr.WriteInteger(1)
+	if err := wr.WriteValue(ArrayValue([]Value{{}})); err == nil {
+		t.Fatal("expected error")
+	}
+	if wr.Buffered() != 4 {
+		t.Fatalf("expected 4, got %v", wr.Buffered())
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	wr := NewWriter(&failWriter{n: 11})
+	if err := wr.WriteString("HELLO"); err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.WriteString("HELLO"); err == nil || err.Error() != "write failed" {
+		t.Fatalf("expected 'write failed', got '%v'", err)
+	}
+	if err := wr.WriteInteger(1); err == nil || err.Error() != "write failed" {
+		t.Fatalf("expected 'write failed', got '%v'", err)
+	}
+	wr = NewWriterSize(&failWriter{n: 10}, 0)
+	wr.WriteString("HELLO")
+	wr.WriteString("HELLO")
+	if err := wr.Flush(); err == nil || err.Error() != "write failed" {
+		t.Fatalf("expected 'write failed', got '%v'", err)
+	}
+	if wr.Buffered() != 12 {
+		t.Fatalf("expected 12, got %v", wr.Buffered())
+	}
+}
+
+func TestAppend(t *testing.T) {
+	var dst []byte
+	dst = AppendArrayHeader(dst, 7)
+	dst = AppendBulkString(dst, "HELLO")
+	dst = AppendBulk(dst, []byte("WORLD"))
+	dst = AppendSimpleString(dst, "OK\r\n")
+	dst = AppendError(dst, "ERR bad")
+	dst = AppendInt(dst, -12)
+	dst = AppendNull(dst)
+	dst = AppendNullArray(dst)
+	res := "" +
+		"*7\r\n" +
+		"$5\r\nHELLO\r\n" +
+		"$5\r\nWORLD\r\n" +
+		"+OK  \r\n" +
+		"-ERR bad\r\n" +
+		":-12\r\n" +
+		"$-1\r\n" +
+		"*-1\r\n"
+	if string(dst) != res {
+		t.Fatalf("expected '%v', got '%v'", res, string(dst))
+	}
+	v := ArrayValue([]Value{
+		StringValue("HELLO"), IntegerValue(1),
+		ArrayValue([]Value{SimpleStringValue("OK"), NullValue()}),
+	})
+	data, err := v.MarshalRESP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst = AppendValue([]byte("prefix"), v)
+	if string(dst) != "prefix"+string(data) {
+		t.Fatalf("expected '%v', got '%v'", "prefix"+string(data), string(dst))
+	}
+	dst = AppendValue(nil, ArrayValue([]Value{{}}))
+	if string(dst) != "*1\r\n$-1\r\n" {
+		t.Fatalf("expected '%v', got '%v'", "*1\r\n$-1\r\n", string(dst))
+	}
+	buf := make([]byte, 0, 256)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = AppendValue(buf[:0], v)
+	})
+	if allocs != 0 {
+		t.Fatalf("expected 0 allocations, got %v", allocs)
+	}
+}
+
 func randRESPInteger() string {
 	return fmt.Sprintf(":%d\r\n", (randInt()%1000000)-500000)
 }
@@ -386,3 +778,17 @@ func BenchmarkRead(b *testing.B) {
 	}
 	//fmt.Printf("\n%f\n", float64(k)/(float64(time.Now().Sub(start))/float64(time.Second)))
 }
+
+func BenchmarkAppendValue(b *testing.B) {
+	vals := make([]Value, 100)
+	for i := range vals {
+		vals[i] = StringValue(fmt.Sprintf("value:%d", i))
+	}
+	v := ArrayValue(vals)
+	var buf []byte
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf = AppendValue(buf[:0], v)
+	}
+}
@@ -1,26 +1,136 @@
 package resp
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
 	"io"
+	"log"
 	"net"
+	"os"
+	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Server represents a RESP server which handles reading RESP Values.
 type Server struct {
+	// RelaxedCommands allows for command arguments of any RESP type, such as integers
+	// and nested arrays, which are passed to the handlers as is. By default the arguments
+	// must be bulk strings, like Redis.
+	RelaxedCommands bool
+
+	// TLSConfig optionally provides a TLS configuration for use by ServeTLS and
+	// ListenAndServeTLS. Set ClientAuth and ClientCAs to authenticate clients by
+	// certificate, which is then available from Conn.PeerCertificate.
+	TLSConfig *tls.Config
+
+	// ShutdownError is an optional error that is written to idle connections before
+	// they are closed by Shutdown.
+	ShutdownError error
+
+	// MaxClients is the maximum number of connections that are served at the same time.
+	// Connections over the limit are sent an error and closed. Zero means no limit.
+	MaxClients int
+
+	// IdleTimeout is the maximum amount of time to wait for the next command.
+	// Idle connections are closed after the timeout. Zero means no timeout.
+	IdleTimeout time.Duration
+
+	// ReadTimeout is the maximum amount of time for reading a command, starting from the
+	// moment its first byte arrives. It's also used for the TLS handshake. Zero means no timeout.
+	ReadTimeout time.Duration
+
+	// WriteTimeout is the maximum amount of time for handling a command and writing its reply,
+	// starting from the moment the command has been read. Zero means no timeout.
+	WriteTimeout time.Duration
+
+	// ErrorLog specifies an optional logger for panics that are recovered from command handlers.
+	// If nil, logging is done via the log package's standard logger.
+	//
+	// A panic closes only the connection of the command. The partial reply of the command is discarded
+	// and the client is sent an ERR internal error reply. When a part of the reply was already written
+	// to the connection, the connection is closed without the error reply, because it can't follow a
+	// partial reply.
+	ErrorLog *log.Logger
+
+	// OnConnect is called when a connection has been accepted, prior to the AcceptFunc.
+	OnConnect func(conn *Conn)
+
+	// OnDisconnect is called after a connection has been closed. The err is the error that ended the
+	// connection, such as io.EOF when the client hung up, a protocol error, or a timeout. It's nil when
+	// the connection was closed by the server, by a QUIT command, or by a handler returning false.
+	OnDisconnect func(conn *Conn, err error)
+
+	// OnCommand is called before a command runs.
+	OnCommand func(conn *Conn, args []Value)
+
+	// OnCommandDone is called after a command has run. The d is the duration of the command and
+	// err is the first error that was written through the Conn by the command, either as its reply or as an
+	// element of a streamed array, if any. It's a *RedisError.
+	OnCommandDone func(conn *Conn, args []Value, d time.Duration, err error)
+
 	mu       sync.RWMutex
-	handlers map[string]func(conn *Conn, args []Value) bool
+	mux      *ServeMux
+	builtins *ServeMux
 	accept   func(conn *Conn) bool
+
+	lmu        sync.Mutex
+	listeners  map[net.Listener]struct{}
+	conns      map[*Conn]struct{}
+	inShutdown atomic.Bool
+	lastID     atomic.Uint64
+	pauseUntil atomic.Int64
 }
 
+// ErrServerClosed is returned by the Serve methods after a call to Shutdown or Close.
+var ErrServerClosed = errors.New("server closed")
+
+var errMaxClients = NewRedisError("ERR", "max number of clients reached")
+
+// connection states used for graceful shutdowns
+const (
+	connActive int32 = iota // running the accept function or a command
+	connIdle                // waiting for the next command
+	connClosed              // closed by the server
+)
+
 // Conn represents a RESP network connection.
 type Conn struct {
 	*Reader
 	*Writer
 	base       net.Conn
 	RemoteAddr string
+	LocalAddr  string
+
+	// ID is the unique identifier of a connection that was accepted by the Server.
+	// IDs start at 1 and increase by one for every accepted connection.
+	ID uint64
+
+	// Created is the time the connection was created.
+	Created time.Time
+
+	// TLS contains the state of a TLS connection that was accepted by the Server.
+	// It's nil for plain connections.
+	TLS *tls.ConnectionState
+
+	ctx        interface{}
+	state      atomic.Int32
+	out        *writeCounter // counts the bytes written to the connection by a Server
+	cmdMark    int           // size of the write buffer before the current command
+	cmdWritten int64         // bytes written to the connection before the current command
+	errReply   error         // first error written by the current command
+	server     bool          // accepted by a Server, which tracks the errReply
+
+	mu         sync.Mutex
+	name       string
+	user       string
+	lastCmd    string
+	lastActive time.Time
 }
 
 // NewConn returns a Conn.
@@ -30,23 +140,152 @@ func NewConn(conn net.Conn) *Conn {
 		Writer:     NewWriter(conn),
 		base:       conn,
 		RemoteAddr: conn.RemoteAddr().String(),
+		LocalAddr:  conn.LocalAddr().String(),
+		Created:    time.Now(),
+	}
+}
+
+// newServerConn returns a Conn with a buffered Writer. The buffer is flushed
+// when the Reader needs more data from the connection, which happens once all
+// pipelined commands have been processed.
+func newServerConn(conn net.Conn) *Conn {
+	out := &writeCounter{wr: conn}
+	wr := NewWriterSize(out, bufsz)
+	return &Conn{
+		out:        out,
+		Reader:     NewReader(&flushReader{rd: conn, wr: wr}),
+		Writer:     wr,
+		base:       conn,
+		RemoteAddr: conn.RemoteAddr().String(),
+		LocalAddr:  conn.LocalAddr().String(),
+		Created:    time.Now(),
+		server:     true,
+	}
+}
+
+// writeCounter counts the bytes that are written to an io.Writer.
+type writeCounter struct {
+	wr io.Writer
+	n  int64
+}
+
+func (w *writeCounter) Write(p []byte) (int, error) {
+	n, err := w.wr.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// flushReader flushes a Writer prior to reading.
+type flushReader struct {
+	rd io.Reader
+	wr *Writer
+}
+
+func (r *flushReader) Read(p []byte) (int, error) {
+	if err := r.wr.Flush(); err != nil {
+		return 0, err
+	}
+	return r.rd.Read(p)
+}
+
+// WriteValue writes a RESP Value.
+func (conn *Conn) WriteValue(v Value) error {
+	if conn.server && v.typ == '-' && conn.errReply == nil {
+		conn.errReply = v.Error()
+	}
+	return conn.Writer.WriteValue(v)
+}
+
+// WriteError writes a RESP error.
+func (conn *Conn) WriteError(err error) error {
+	return conn.WriteValue(ErrorValue(err))
+}
+
+// Context returns a user-defined context, such as the selected database, the authenticated user,
+// or a transaction queue. It's nil until SetContext is called.
+func (conn *Conn) Context() interface{} {
+	return conn.ctx
+}
+
+// SetContext sets a user-defined context.
+func (conn *Conn) SetContext(v interface{}) {
+	conn.ctx = v
+}
+
+// NetConn returns the underlying net.Conn.
+func (conn *Conn) NetConn() net.Conn {
+	return conn.base
+}
+
+// PeerCertificate returns the verified certificate which the client presented during the TLS handshake.
+// Returns nil if the connection is not using TLS or when the client did not present a verified certificate.
+func (conn *Conn) PeerCertificate() *x509.Certificate {
+	if conn.TLS == nil || len(conn.TLS.VerifiedChains) == 0 || len(conn.TLS.VerifiedChains[0]) == 0 {
+		return nil
 	}
+	return conn.TLS.VerifiedChains[0][0]
 }
 
 // NewServer returns a new Server.
 func NewServer() *Server {
-	return &Server{
-		handlers: make(map[string]func(conn *Conn, args []Value) bool),
-	}
+	s := &Server{}
+	s.builtins = NewServeMux()
+	s.builtins.HandleCommand(Command{Name: "quit", Arity: -1, Flags: CommandFast}, quitCommand)
+	s.builtins.HandleCommand(Command{Name: "ping", Arity: -1, Flags: CommandFast}, pingCommand)
+	s.handleClientCommands(s.builtins)
+	s.handleCommandCommands(s.builtins)
+	s.mux = newServeMux(s.builtins)
+	return s
+}
+
+// Handle registers the handler for the given command. See HandleFunc.
+func (s *Server) Handle(command string, handler Handler) {
+	s.mux.Handle(command, handler)
 }
 
 // HandleFunc registers the handler function for the given command.
+// Registering a handler for PING, QUIT, CLIENT, or COMMAND replaces the built-in command.
 // The conn parameter is a Conn type and it can be used to read and write further RESP messages from and to the connection.
 // Returning false will close the connection.
+//
+// Replies are buffered and written to the connection once all commands that the client has pipelined have
+// been handled, or when the handler reads from the connection. A handler that keeps writing without
+// returning, such as for a subscription, must call conn.Flush.
 func (s *Server) HandleFunc(command string, handler func(conn *Conn, args []Value) bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.handlers[strings.ToUpper(command)] = handler
+	s.mux.HandleFunc(command, handler)
+}
+
+// HandleCommand registers the handler function for the command that is described by cmd. The server
+// checks the number of arguments before calling the handler, and reports the command with COMMAND,
+// COMMAND COUNT, COMMAND INFO, and COMMAND GETKEYS. See HandleFunc and ServeMux.HandleCommand.
+func (s *Server) HandleCommand(cmd Command, handler func(conn *Conn, args []Value) bool) {
+	s.mux.HandleCommand(cmd, handler)
+}
+
+// HandleSubFunc registers the handler function for a subcommand, such as CONFIG GET.
+// Subcommands of CLIENT and COMMAND are added to the built-in subcommands, replacing the built-in
+// subcommand of the same name. See ServeMux.HandleSubFunc.
+func (s *Server) HandleSubFunc(command, subcommand string, handler func(conn *Conn, args []Value) bool) {
+	s.mux.HandleSubFunc(command, subcommand, handler)
+}
+
+// Use appends middleware to the server. The middleware wraps every command handler, including
+// the built-in commands and the reply to unknown commands. The first middleware is the outermost.
+func (s *Server) Use(mws ...Middleware) {
+	s.mux.Use(mws...)
+}
+
+// Group returns a new command group with the middleware. The middleware only wraps the handlers that
+// are registered with the group, and runs after the middleware of the server.
+func (s *Server) Group(mws ...Middleware) *Group {
+	return s.mux.Group(mws...)
+}
+
+// Mount adds the commands of a ServeMux to the server, allowing for several servers to share one
+// routing table. Commands that are registered with the server itself take precedence, and the
+// built-in commands are only used when no handler matches.
+func (s *Server) Mount(mux *ServeMux) {
+	s.mux.Mount(mux)
 }
 
 // AcceptFunc registers a function for accepting connections.
@@ -64,28 +303,270 @@ func (s *Server) ListenAndServe(addr string) error {
 	if err != nil {
 		return err
 	}
+	return s.Serve(l)
+}
+
+// Serve accepts incoming connections on the Listener l, creating a new goroutine for each.
+// The listener can be of any kind, such as TCP, Unix domain sockets, or an in-memory listener.
+// Serve always returns a non-nil error and closes l.
+func (s *Server) Serve(l net.Listener) error {
 	defer l.Close()
+	if !s.trackListener(l, true) {
+		return ErrServerClosed
+	}
+	defer s.trackListener(l, false)
 	for {
 		conn, err := l.Accept()
 		if err != nil {
+			if s.inShutdown.Load() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Shutdown gracefully shuts down the server. It stops accepting new connections, closes all idle
+// connections, and waits for the active connections to finish their current command before closing
+// them. When the ShutdownError is set, it's written to the idle connections before closing.
+// If the context expires before all connections have been closed, the remaining connections are
+// forcefully closed and the context's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.inShutdown.Store(true)
+	err := s.closeListeners()
+	ticker := time.NewTicker(time.Millisecond * 10)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			s.closeConns()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close immediately closes all listeners and connections, without waiting for active commands to finish.
+// For a graceful shutdown use Shutdown.
+func (s *Server) Close() error {
+	s.inShutdown.Store(true)
+	err := s.closeListeners()
+	s.closeConns()
+	return err
+}
+
+// trackListener adds or removes a listener. Returns false when a listener is
+// added to a server that is shutting down.
+func (s *Server) trackListener(l net.Listener, add bool) bool {
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+	if !add {
+		delete(s.listeners, l)
+		return true
+	}
+	if s.inShutdown.Load() {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+// closeTimeout returns the maximum amount of time for writing an error to a connection
+// that is being closed by the server, which is the WriteTimeout or one second.
+func (s *Server) closeTimeout() time.Duration {
+	if s.WriteTimeout > 0 {
+		return s.WriteTimeout
+	}
+	return time.Second
+}
+
+// addConn adds a connection. Returns ErrServerClosed when the server is shutting
+// down, or errMaxClients when the server is at the MaxClients limit.
+func (s *Server) addConn(conn *Conn) error {
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+	if s.inShutdown.Load() {
+		return ErrServerClosed
+	}
+	if s.MaxClients > 0 && len(s.conns) >= s.MaxClients {
+		return errMaxClients
+	}
+	if s.conns == nil {
+		s.conns = make(map[*Conn]struct{})
+	}
+	s.conns[conn] = struct{}{}
+	return nil
+}
+
+func (s *Server) removeConn(conn *Conn) {
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+	delete(s.conns, conn)
+}
+
+func (s *Server) closeListeners() error {
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// closeIdleConns closes the connections that are waiting for their next command.
+// Returns true when there are no connections remaining.
+func (s *Server) closeIdleConns() bool {
+	var idle []*Conn
+	s.lmu.Lock()
+	for conn := range s.conns {
+		if conn.state.CompareAndSwap(connIdle, connClosed) {
+			idle = append(idle, conn)
+		}
+	}
+	done := len(s.conns) == 0
+	s.lmu.Unlock()
+	for _, conn := range idle {
+		if s.ShutdownError != nil {
+			conn.base.SetDeadline(time.Now().Add(s.closeTimeout()))
+			conn.base.Write(AppendError(nil, s.ShutdownError.Error()))
+		}
+		conn.base.Close()
+	}
+	return done
+}
+
+func (s *Server) closeConns() {
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+	for conn := range s.conns {
+		conn.state.Store(connClosed)
+		conn.base.Close()
+	}
+}
+
+// ListenAndServeTLS listens on the TCP network address addr for incoming TLS connections.
+// See ServeTLS for the certFile and keyFile parameters.
+func (s *Server) ListenAndServeTLS(addr, certFile, keyFile string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeTLS(l, certFile, keyFile)
+}
+
+// ServeTLS accepts incoming TLS connections on the Listener l using the TLSConfig of the Server.
+// The certFile and keyFile are the paths to a PEM encoded certificate and its private key.
+// They may be empty when the TLSConfig already provides the certificates.
+// ServeTLS always returns a non-nil error and closes l.
+func (s *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
+	config := &tls.Config{}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			l.Close()
 			return err
 		}
-		go func() {
-			err = s.handleConn(conn)
-			if err != nil {
-				if _, ok := err.(*errProtocol); ok {
-					io.WriteString(conn, "-ERR "+formSingleLine(err.Error())+"\r\n")
-				} else {
-					io.WriteString(conn, "-ERR unknown error\r\n")
-				}
+		config.Certificates = append([]tls.Certificate{cert}, config.Certificates...)
+	}
+	return s.Serve(tls.NewListener(l, config))
+}
+
+func (s *Server) serveConn(nconn net.Conn) {
+	conn := newServerConn(nconn)
+	conn.ID = s.lastID.Add(1)
+	if err := s.addConn(conn); err != nil {
+		if err == errMaxClients {
+			// the deadline covers the TLS handshake, which needs to read from the client
+			nconn.SetDeadline(time.Now().Add(s.closeTimeout()))
+			conn.WriteError(err)
+			conn.Flush()
+		}
+		nconn.Close()
+		return
+	}
+	if s.OnConnect != nil {
+		s.OnConnect(conn)
+	}
+	err := s.recoverConn(conn)
+	conn.Flush()
+	s.removeConn(conn)
+	if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+		if perr, ok := err.(*errPanic); ok {
+			if !perr.partial {
+				io.WriteString(nconn, "-ERR internal error\r\n")
 			}
-			conn.Close()
-		}()
+		} else if _, ok := err.(*errProtocol); ok {
+			io.WriteString(nconn, "-ERR "+formSingleLine(err.Error())+"\r\n")
+		} else {
+			io.WriteString(nconn, "-ERR unknown error\r\n")
+		}
+	}
+	nconn.Close()
+	if s.OnDisconnect != nil {
+		s.OnDisconnect(conn, err)
 	}
 }
 
-func (s *Server) handleConn(nconn net.Conn) error {
-	conn := NewConn(nconn)
+// errPanic is the error of a connection that was closed due to a panic.
+type errPanic struct {
+	v       interface{}
+	partial bool // a part of the reply was written to the connection
+}
+
+func (err *errPanic) Error() string {
+	return fmt.Sprintf("panic: %v", err.v)
+}
+
+// recoverConn handles the connection and recovers from panics, which only close the connection.
+func (s *Server) recoverConn(conn *Conn) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			stack := debug.Stack()
+			if s.ErrorLog != nil {
+				s.ErrorLog.Printf("resp: panic serving %s: %v\n%s", conn.RemoteAddr, v, stack)
+			} else {
+				log.Printf("resp: panic serving %s: %v\n%s", conn.RemoteAddr, v, stack)
+			}
+			// discard the partial reply of the command that panicked
+			partial := conn.out.n != conn.cmdWritten
+			if partial {
+				// the buffer only holds the rest of the reply
+				conn.Writer.buf = conn.Writer.buf[:0]
+			} else if conn.Writer.err == nil && conn.cmdMark <= len(conn.Writer.buf) {
+				conn.Writer.buf = conn.Writer.buf[:conn.cmdMark]
+			}
+			err = &errPanic{v: v, partial: partial}
+		}
+	}()
+	return s.handleConn(conn)
+}
+
+func (s *Server) handleConn(conn *Conn) error {
+	conn.SetRelaxedMultiBulk(s.RelaxedCommands)
+	if tconn, ok := conn.base.(*tls.Conn); ok {
+		if s.ReadTimeout > 0 {
+			tconn.SetDeadline(time.Now().Add(s.ReadTimeout))
+		}
+		if err := tconn.Handshake(); err != nil {
+			return err
+		}
+		tconn.SetDeadline(time.Time{})
+		state := tconn.ConnectionState()
+		conn.TLS = &state
+	}
 	s.mu.RLock()
 	accept := s.accept
 	s.mu.RUnlock()
@@ -95,7 +576,31 @@ func (s *Server) handleConn(nconn net.Conn) error {
 		}
 	}
 	for {
-		v, _, _, err := conn.ReadMultiBulk()
+		// A connection only counts as idle once its replies have been sent, because an idle
+		// connection may be closed by Shutdown at any time. A connection with pipelined commands
+		// stays active and keeps buffering its replies.
+		pipelined := conn.Reader.rd.Buffered() > 0
+		if !pipelined || s.inShutdown.Load() {
+			if err := conn.Flush(); err != nil {
+				return err
+			}
+		}
+		if pipelined {
+			if conn.state.Load() != connActive {
+				// closed by the server
+				return nil
+			}
+		} else if !conn.state.CompareAndSwap(connActive, connIdle) {
+			return nil
+		}
+		if s.inShutdown.Load() {
+			return nil
+		}
+		v, err := s.readCommand(conn)
+		if !pipelined && !conn.state.CompareAndSwap(connIdle, connActive) {
+			// closed by the server
+			return nil
+		}
 		if err != nil {
 			return err
 		}
@@ -103,33 +608,74 @@ func (s *Server) handleConn(nconn net.Conn) error {
 		if len(values) == 0 {
 			continue
 		}
-		lccommandName := values[0].String()
-		commandName := strings.ToUpper(lccommandName)
-		s.mu.RLock()
-		h := s.handlers[commandName]
-		s.mu.RUnlock()
-		switch commandName {
-		case "QUIT":
-			if h == nil {
-				conn.WriteSimpleString("OK")
-				return nil
-			}
-		case "PING":
-			if h == nil {
-				if err := conn.WriteSimpleString("PONG"); err != nil {
-					return err
-				}
-				continue
-			}
+		if s.WriteTimeout > 0 {
+			conn.base.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
 		}
-		if h == nil {
-			if err := conn.WriteError(errors.New("ERR unknown command '" + lccommandName + "'")); err != nil {
-				return err
-			}
-		} else {
-			if !h(conn, values) {
-				return nil
-			}
+		if !s.execCommand(conn, values) {
+			return nil
+		}
+	}
+}
+
+// execCommand runs a command. Returns false when the connection must be closed.
+func (s *Server) execCommand(conn *Conn, args []Value) bool {
+	lccommandName := args[0].String()
+	commandName := strings.ToUpper(lccommandName)
+	if commandName != "CLIENT" {
+		s.waitPause()
+	}
+	conn.setCommand(strings.ToLower(lccommandName))
+	h := s.mux.lookup(commandName)
+	conn.cmdMark = conn.Writer.Buffered()
+	conn.cmdWritten = conn.out.n
+	if s.OnCommand == nil && s.OnCommandDone == nil {
+		return h(conn, args)
+	}
+	if s.OnCommand != nil {
+		s.OnCommand(conn, args)
+	}
+	start := time.Now()
+	conn.errReply = nil
+	keep := h(conn, args)
+	if s.OnCommandDone != nil {
+		s.OnCommandDone(conn, args, time.Since(start), conn.errReply)
+	}
+	return keep
+}
+
+func quitCommand(conn *Conn, args []Value) bool {
+	conn.WriteSimpleString("OK")
+	return false
+}
+
+func pingCommand(conn *Conn, args []Value) bool {
+	conn.WriteSimpleString("PONG")
+	return true
+}
+
+func unknownCommand(conn *Conn, args []Value) bool {
+	conn.WriteError(ErrUnknownCommand(args[0].String()))
+	return true
+}
+
+// readCommand reads the next command while applying the IdleTimeout and ReadTimeout.
+func (s *Server) readCommand(conn *Conn) (Value, error) {
+	if s.IdleTimeout > 0 || s.ReadTimeout > 0 {
+		var deadline time.Time
+		if s.IdleTimeout > 0 {
+			deadline = time.Now().Add(s.IdleTimeout)
+		}
+		conn.base.SetReadDeadline(deadline)
+		// wait for the first byte of the command
+		if _, err := conn.Reader.rd.Peek(1); err != nil {
+			return nullValue, err
+		}
+		deadline = time.Time{}
+		if s.ReadTimeout > 0 {
+			deadline = time.Now().Add(s.ReadTimeout)
 		}
+		conn.base.SetReadDeadline(deadline)
 	}
+	v, _, _, err := conn.ReadMultiBulk()
+	return v, err
 }
@@ -1,10 +1,26 @@
 package resp
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math/big"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -31,62 +47,806 @@ func TestServer(t *testing.T) {
 			}()
 			nconn, err := net.Dial("tcp", ":6380")
 			if err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 			defer nconn.Close()
 			conn := NewConn(nconn)
 
 			// PING
 			if err := conn.WriteMultiBulk("PING"); err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 			val, _, err := conn.ReadValue()
 			if err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 			if val.String() != "PONG" {
-				t.Fatalf("expecting 'PONG', got '%s'", val)
+				t.Errorf("expecting 'PONG', got '%s'", val)
+				return
 			}
 
 			key := fmt.Sprintf("key:%d", i)
 
 			// SET
 			if err := conn.WriteMultiBulk("SET", key, 123.4); err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 			val, _, err = conn.ReadValue()
 			if err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 			if val.String() != "OK" {
-				t.Fatalf("expecting 'OK', got '%s'", val)
+				t.Errorf("expecting 'OK', got '%s'", val)
+				return
 			}
 
 			// GET
 			if err := conn.WriteMultiBulk("GET", key); err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 			val, _, err = conn.ReadValue()
 			if err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 			if val.Float() != 123.4 {
-				t.Fatalf("expecting '123.4', got '%s'", val)
+				t.Errorf("expecting '123.4', got '%s'", val)
+				return
 			}
 
 			// QUIT
 			if err := conn.WriteMultiBulk("QUIT"); err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 			val, _, err = conn.ReadValue()
 			if err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 			if val.String() != "OK" {
-				t.Fatalf("expecting 'OK', got '%s'", val)
+				t.Errorf("expecting 'OK', got '%s'", val)
+				return
 			}
 
 		}(i)
 	}
 	wg.Wait()
 }
+
+func TestServerRelaxedCommands(t *testing.T) {
+	s := NewServer()
+	s.RelaxedCommands = true
+	s.HandleFunc("sum", func(conn *Conn, args []Value) bool {
+		var sum int
+		for _, arg := range args[1:] {
+			if arg.Type() != Integer {
+				conn.WriteError(errors.New("ERR expected integers"))
+				return true
+			}
+			sum += arg.Integer()
+		}
+		conn.WriteInteger(sum)
+		return true
+	})
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	go s.serveConn(c2)
+	conn := NewConn(c1)
+	conn.WriteValue(CommandValue("SUM", IntegerValue(1), IntegerValue(2)))
+	v, _, err := conn.ReadValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Integer() != 3 {
+		t.Fatalf("expected 3, got '%v'", v)
+	}
+	conn.WriteMultiBulk("SUM", 1, 2)
+	v, _, err = conn.ReadValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Error() == nil {
+		t.Fatalf("expected error, got '%v'", v)
+	}
+}
+
+func testServeListener(t *testing.T, l net.Listener) {
+	s := NewServer()
+	s.HandleFunc("echo", func(conn *Conn, args []Value) bool {
+		conn.WriteValue(args[1])
+		return true
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(l)
+	}()
+	nconn, err := net.Dial(l.Addr().Network(), l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nconn.Close()
+	conn := NewConn(nconn)
+	conn.WriteMultiBulk("ECHO", "hello")
+	v, _, err := conn.ReadValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "hello" {
+		t.Fatalf("expected 'hello', got '%v'", v)
+	}
+	l.Close()
+	if err := <-done; err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestServeTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testServeListener(t, l)
+}
+
+func TestServeUnix(t *testing.T) {
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "resp.sock"))
+	if err != nil {
+		t.Skip(err)
+	}
+	testServeListener(t, l)
+}
+
+func testCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder})
+}
+
+func TestServeTLS(t *testing.T) {
+	ca, caKey, _, _ := testCert(t, "ca", nil, nil)
+	_, _, certPEM, keyPEM := testCert(t, "server", ca, caKey)
+	_, _, clientCertPEM, clientKeyPEM := testCert(t, "client", ca, caKey)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	s := NewServer()
+	s.TLSConfig = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: pool}
+	s.HandleFunc("whoami", func(conn *Conn, args []Value) bool {
+		if cert := conn.PeerCertificate(); cert != nil {
+			conn.WriteString(cert.Subject.CommonName)
+		} else {
+			conn.WriteNull()
+		}
+		return true
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go s.ServeTLS(l, certFile, keyFile)
+
+	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, certs := range [][]tls.Certificate{nil, {clientCert}} {
+		nconn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{RootCAs: pool, Certificates: certs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn := NewConn(nconn)
+		conn.WriteMultiBulk("WHOAMI")
+		v, _, err := conn.ReadValue()
+		nconn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if certs == nil && !v.IsNull() {
+			t.Fatalf("expected null, got '%v'", v)
+		}
+		if certs != nil && v.String() != "client" {
+			t.Fatalf("expected 'client', got '%v'", v)
+		}
+	}
+	if err := s.ListenAndServeTLS("127.0.0.1:0", filepath.Join(dir, "missing.pem"), keyFile); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	s := NewServer()
+	s.ShutdownError = errors.New("ERR server is shutting down")
+	started := make(chan bool)
+	s.HandleFunc("slow", func(conn *Conn, args []Value) bool {
+		started <- true
+		time.Sleep(time.Millisecond * 100)
+		conn.WriteSimpleString("DONE")
+		return true
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(l)
+	}()
+	dial := func() *Conn {
+		nconn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn := NewConn(nconn)
+		// wait for the server to be serving the connection
+		conn.WriteMultiBulk("PING")
+		if v, _, err := conn.ReadValue(); err != nil || v.String() != "PONG" {
+			t.Fatalf("expected 'PONG', got '%v' %v", v, err)
+		}
+		return conn
+	}
+	active, idle := dial(), dial()
+	defer active.base.Close()
+	defer idle.base.Close()
+	active.WriteMultiBulk("SLOW")
+	<-started
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != ErrServerClosed {
+		t.Fatalf("expected '%v', got '%v'", ErrServerClosed, err)
+	}
+	// the active connection finishes its command
+	if v, _, err := active.ReadValue(); err != nil || v.String() != "DONE" {
+		t.Fatalf("expected 'DONE', got '%v' %v", v, err)
+	}
+	if _, _, err := active.ReadValue(); err != io.EOF {
+		t.Fatalf("expected '%v', got '%v'", io.EOF, err)
+	}
+	// the idle connection receives the shutdown error
+	if v, _, err := idle.ReadValue(); err != nil || v.String() != "ERR server is shutting down" {
+		t.Fatalf("expected 'ERR server is shutting down', got '%v' %v", v, err)
+	}
+	if err := s.Serve(l); err != ErrServerClosed {
+		t.Fatalf("expected '%v', got '%v'", ErrServerClosed, err)
+	}
+}
+
+// slowConn is a net.Conn with slow writes.
+type slowConn struct {
+	net.Conn
+}
+
+func (c slowConn) Write(p []byte) (int, error) {
+	time.Sleep(time.Millisecond * 30)
+	return c.Conn.Write(p)
+}
+
+func TestServerShutdownFlush(t *testing.T) {
+	s := NewServer()
+	s.ShutdownError = errors.New("ERR server is shutting down")
+	started := make(chan bool)
+	s.HandleFunc("done", func(conn *Conn, args []Value) bool {
+		started <- true
+		conn.WriteSimpleString("DONE")
+		return true
+	})
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	go s.serveConn(slowConn{c2})
+	conn := NewConn(c1)
+	go conn.WriteMultiBulk("DONE")
+	<-started
+	go s.Shutdown(context.Background())
+	// the reply is sent before the connection is closed as idle
+	if v, _, err := conn.ReadValue(); err != nil || v.String() != "DONE" {
+		t.Fatalf("expected 'DONE', got '%v' %v", v, err)
+	}
+	if v, _, err := conn.ReadValue(); err != io.EOF && (err != nil || v.String() != "ERR server is shutting down") {
+		t.Fatalf("expected 'ERR server is shutting down', got '%v' %v", v, err)
+	}
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	s := NewServer()
+	started := make(chan bool)
+	s.HandleFunc("block", func(conn *Conn, args []Value) bool {
+		started <- true
+		time.Sleep(time.Second)
+		return true
+	})
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	go s.serveConn(c2)
+	NewConn(c1).WriteMultiBulk("BLOCK")
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected '%v', got '%v'", context.DeadlineExceeded, err)
+	}
+	if _, err := c1.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected '%v', got '%v'", io.EOF, err)
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	s := NewServer()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(l)
+	}()
+	nconn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nconn.Close()
+	conn := NewConn(nconn)
+	conn.WriteMultiBulk("PING")
+	conn.ReadValue()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != ErrServerClosed {
+		t.Fatalf("expected '%v', got '%v'", ErrServerClosed, err)
+	}
+	if _, _, err := conn.ReadValue(); err != io.EOF {
+		t.Fatalf("expected '%v', got '%v'", io.EOF, err)
+	}
+}
+
+type countConn struct {
+	net.Conn
+	writes atomic.Int32
+}
+
+func (c *countConn) Write(p []byte) (int, error) {
+	c.writes.Add(1)
+	return c.Conn.Write(p)
+}
+
+func TestServerPipelining(t *testing.T) {
+	s := NewServer()
+	s.HandleFunc("echo", func(conn *Conn, args []Value) bool {
+		conn.WriteValue(args[1])
+		return true
+	})
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	cc := &countConn{Conn: c2}
+	go s.serveConn(cc)
+	var buf []byte
+	n := 100
+	for i := 0; i < n; i++ {
+		buf = AppendValue(buf, MultiBulkValue("ECHO", i))
+	}
+	if _, err := c1.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	rd := NewReader(c1)
+	for i := 0; i < n; i++ {
+		v, _, err := rd.ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Integer() != i {
+			t.Fatalf("expected %v, got '%v'", i, v)
+		}
+	}
+	if writes := cc.writes.Load(); writes != 1 {
+		t.Fatalf("expected 1, got %v", writes)
+	}
+	// a lone command is replied to right away
+	NewWriter(c1).WriteMultiBulk("ECHO", "hello")
+	if v, _, err := rd.ReadValue(); err != nil || v.String() != "hello" {
+		t.Fatalf("expected 'hello', got '%v' %v", v, err)
+	}
+}
+
+func TestServerMaxClients(t *testing.T) {
+	s := NewServer()
+	s.MaxClients = 1
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	go s.serveConn(c2)
+	conn := NewConn(c1)
+	conn.WriteMultiBulk("PING")
+	if v, _, err := conn.ReadValue(); err != nil || v.String() != "PONG" {
+		t.Fatalf("expected 'PONG', got '%v' %v", v, err)
+	}
+	c3, c4 := net.Pipe()
+	defer c3.Close()
+	go s.serveConn(c4)
+	rd := NewReader(c3)
+	if v, _, err := rd.ReadValue(); err != nil || v.String() != "ERR max number of clients reached" {
+		t.Fatalf("expected 'ERR max number of clients reached', got '%v' %v", v, err)
+	}
+	if _, _, err := rd.ReadValue(); err != io.EOF {
+		t.Fatalf("expected '%v', got '%v'", io.EOF, err)
+	}
+	// clients over the limit that do not read the error are closed after the WriteTimeout
+	s.WriteTimeout = time.Millisecond * 20
+	c5, c6 := net.Pipe()
+	defer c5.Close()
+	done := make(chan bool)
+	go func() {
+		s.serveConn(c6)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected connection to be closed")
+	}
+}
+
+func TestServerTimeouts(t *testing.T) {
+	s := NewServer()
+	s.IdleTimeout = time.Millisecond * 100
+	s.ReadTimeout = time.Millisecond * 20
+	s.WriteTimeout = time.Millisecond * 20
+	s.HandleFunc("big", func(conn *Conn, args []Value) bool {
+		conn.WriteString(strings.Repeat("A", 1024*1024))
+		return true
+	})
+	serve := func() (net.Conn, chan bool) {
+		c1, c2 := net.Pipe()
+		done := make(chan bool)
+		go func() {
+			s.serveConn(c2)
+			close(done)
+		}()
+		return c1, done
+	}
+	// the timers start before sending the command, because the server may time out
+	// before the write to the pipe returns
+	wait := func(what string, done chan bool, min time.Duration, start time.Time) {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("%s: expected connection to be closed", what)
+		}
+		if time.Since(start) < min {
+			t.Fatalf("%s: closed too early", what)
+		}
+	}
+
+	// idle clients are closed after the IdleTimeout, not the ReadTimeout
+	c, done := serve()
+	start := time.Now()
+	wait("idle", done, s.IdleTimeout, start)
+	c.Close()
+
+	// stalled commands are closed after the ReadTimeout
+	c, done = serve()
+	start = time.Now()
+	go c.Write([]byte("*2\r\n$4\r\nECHO\r\n"))
+	wait("read", done, s.ReadTimeout, start)
+	c.Close()
+
+	// clients that do not read their replies are closed after the WriteTimeout
+	c, done = serve()
+	start = time.Now()
+	NewWriter(c).WriteMultiBulk("BIG")
+	wait("write", done, s.WriteTimeout, start)
+	c.Close()
+}
+
+func TestConnState(t *testing.T) {
+	type client struct{ db int }
+	s := NewServer()
+	s.HandleFunc("select", func(conn *Conn, args []Value) bool {
+		conn.SetContext(&client{db: args[1].Integer()})
+		conn.WriteSimpleString("OK")
+		return true
+	})
+	s.HandleFunc("info", func(conn *Conn, args []Value) bool {
+		var db int
+		if c, ok := conn.Context().(*client); ok {
+			db = c.db
+		}
+		if conn.NetConn() == nil || conn.Created.IsZero() || conn.LocalAddr == "" {
+			conn.WriteError(errors.New("ERR missing conn info"))
+			return true
+		}
+		conn.WriteArray([]Value{IntegerValue(int(conn.ID)), IntegerValue(db)})
+		return true
+	})
+	var conns []*Conn
+	for i := 0; i < 2; i++ {
+		c1, c2 := net.Pipe()
+		defer c1.Close()
+		go s.serveConn(c2)
+		conns = append(conns, NewConn(c1))
+	}
+	conns[1].WriteMultiBulk("SELECT", 5)
+	conns[1].ReadValue()
+	ids := make(map[int]bool)
+	for i, conn := range conns {
+		conn.WriteMultiBulk("INFO")
+		v, _, err := conn.ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Error() != nil {
+			t.Fatal(v.Error())
+		}
+		if v.Index(1).Integer() != i*5 {
+			t.Fatalf("expected %v, got '%v'", i*5, v)
+		}
+		ids[v.Index(0).Integer()] = true
+	}
+	if len(ids) != 2 || ids[0] {
+		t.Fatalf("expected unique non-zero ids, got %v", ids)
+	}
+}
+
+func TestServerHooks(t *testing.T) {
+	s := NewServer()
+	var mu sync.Mutex
+	var events []string
+	disconnected := make(chan error, 1)
+	s.OnConnect = func(conn *Conn) {
+		mu.Lock()
+		events = append(events, "connect")
+		mu.Unlock()
+	}
+	s.OnDisconnect = func(conn *Conn, err error) {
+		disconnected <- err
+	}
+	s.OnCommand = func(conn *Conn, args []Value) {
+		mu.Lock()
+		events = append(events, "command "+args[0].String())
+		mu.Unlock()
+	}
+	s.OnCommandDone = func(conn *Conn, args []Value, d time.Duration, err error) {
+		mu.Lock()
+		events = append(events, fmt.Sprintf("done %s %v", args[0], err))
+		mu.Unlock()
+	}
+	s.HandleFunc("fail", func(conn *Conn, args []Value) bool {
+		conn.WriteError(ErrWrongType())
+		conn.WriteError(ErrSyntax())
+		return true
+	})
+	s.HandleFunc("stream", func(conn *Conn, args []Value) bool {
+		conn.WriteArrayHeader(2)
+		conn.WriteString("ok")
+		conn.WriteError(ErrSyntax())
+		return true
+	})
+	for _, quit := range []bool{true, false} {
+		events = nil
+		c1, c2 := net.Pipe()
+		go s.serveConn(c2)
+		conn := NewConn(c1)
+		conn.WriteMultiBulk("PING")
+		conn.ReadValue()
+		conn.WriteMultiBulk("FAIL")
+		conn.ReadValue()
+		conn.ReadValue()
+		conn.WriteMultiBulk("STREAM")
+		conn.ReadValue()
+		if quit {
+			conn.WriteMultiBulk("QUIT")
+			conn.ReadValue()
+		}
+		c1.Close()
+		err := <-disconnected
+		if quit && err != nil {
+			t.Fatalf("expected nil, got '%v'", err)
+		}
+		if !quit && err != io.EOF {
+			t.Fatalf("expected '%v', got '%v'", io.EOF, err)
+		}
+		res := "connect,command PING,done PING <nil>,command FAIL," +
+			"done FAIL WRONGTYPE Operation against a key holding the wrong kind of value," +
+			"command STREAM,done STREAM ERR syntax error"
+		if quit {
+			res += ",command QUIT,done QUIT <nil>"
+		}
+		mu.Lock()
+		if strings.Join(events, ",") != res {
+			t.Fatalf("expected '%v', got '%v'", res, strings.Join(events, ","))
+		}
+		mu.Unlock()
+	}
+}
+
+func TestServerMiddleware(t *testing.T) {
+	s := NewServer()
+	var mu sync.Mutex
+	var trace []string
+	logger := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(conn *Conn, args []Value) bool {
+				mu.Lock()
+				trace = append(trace, name+":"+args[0].String())
+				mu.Unlock()
+				return next(conn, args)
+			}
+		}
+	}
+	auth := func(next HandlerFunc) HandlerFunc {
+		return func(conn *Conn, args []Value) bool {
+			if conn.Context() == nil {
+				conn.WriteError(errors.New("NOAUTH Authentication required."))
+				return true
+			}
+			return next(conn, args)
+		}
+	}
+	s.HandleFunc("auth", func(conn *Conn, args []Value) bool {
+		conn.SetContext(true)
+		conn.WriteSimpleString("OK")
+		return true
+	})
+	s.Use(logger("a"))
+	admin := s.Group(auth, logger("admin"))
+	admin.HandleFunc("flushall", func(conn *Conn, args []Value) bool {
+		conn.WriteSimpleString("OK")
+		return true
+	})
+	s.Use(logger("b"))
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	go s.serveConn(c2)
+	conn := NewConn(c1)
+	for _, cmd := range []struct{ name, reply string }{
+		{"PING", "PONG"},
+		{"FLUSHALL", "NOAUTH Authentication required."},
+		{"AUTH", "OK"},
+		{"FLUSHALL", "OK"},
+		{"FOO", "ERR unknown command 'FOO'"},
+	} {
+		conn.WriteMultiBulk(cmd.name)
+		v, _, err := conn.ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.String() != cmd.reply {
+			t.Fatalf("expected '%v', got '%v'", cmd.reply, v)
+		}
+	}
+	res := "a:PING b:PING a:FLUSHALL b:FLUSHALL a:AUTH b:AUTH " +
+		"a:FLUSHALL b:FLUSHALL admin:FLUSHALL a:FOO b:FOO"
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(trace, " ") != res {
+		t.Fatalf("expected '%v', got '%v'", res, strings.Join(trace, " "))
+	}
+}
+
+func TestServerPanic(t *testing.T) {
+	s := NewServer()
+	var logs bytes.Buffer
+	var mu sync.Mutex
+	s.ErrorLog = log.New(writerFunc(func(p []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return logs.Write(p)
+	}), "", 0)
+	disconnected := make(chan error, 1)
+	s.OnDisconnect = func(conn *Conn, err error) {
+		disconnected <- err
+	}
+	s.HandleFunc("panic", func(conn *Conn, args []Value) bool {
+		conn.WriteArrayHeader(2)
+		conn.WriteString("partial")
+		panic("oops")
+	})
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	go s.serveConn(c2)
+	c3, c4 := net.Pipe()
+	defer c3.Close()
+	go s.serveConn(c4)
+
+	conn := NewConn(c1)
+	c1.Write([]byte("PING\r\nPANIC\r\n"))
+	for _, exp := range []string{"PONG", "ERR internal error"} {
+		v, _, err := conn.ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.String() != exp {
+			t.Fatalf("expected '%v', got '%v'", exp, v)
+		}
+	}
+	if _, _, err := conn.ReadValue(); err != io.EOF {
+		t.Fatalf("expected '%v', got '%v'", io.EOF, err)
+	}
+	if err := <-disconnected; err == nil || err.Error() != "panic: oops" {
+		t.Fatalf("expected 'panic: oops', got '%v'", err)
+	}
+	mu.Lock()
+	if !strings.Contains(logs.String(), "resp: panic serving pipe: oops") ||
+		!strings.Contains(logs.String(), "TestServerPanic") {
+		t.Fatalf("unexpected log '%v'", logs.String())
+	}
+	mu.Unlock()
+
+	// other connections are not affected
+	conn = NewConn(c3)
+	conn.WriteMultiBulk("PING")
+	if v, _, err := conn.ReadValue(); err != nil || v.String() != "PONG" {
+		t.Fatalf("expected 'PONG', got '%v' %v", v, err)
+	}
+}
+
+func TestServerPanicPartialReply(t *testing.T) {
+	s := NewServer()
+	s.ErrorLog = log.New(io.Discard, "", 0)
+	s.HandleFunc("panic", func(conn *Conn, args []Value) bool {
+		conn.WriteArrayHeader(3)
+		conn.WriteString(strings.Repeat("x", bufsz+1000))
+		panic("oops")
+	})
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	go s.serveConn(c2)
+	go c1.Write([]byte("PING\r\nPANIC\r\n"))
+	data, err := io.ReadAll(c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the partial reply can't be followed by an error
+	exp := "+PONG\r\n*3\r\n$5096\r\n"
+	if !strings.HasPrefix(string(data), exp) || strings.Contains(string(data), "internal error") {
+		t.Fatalf("unexpected reply '%.40q'", data)
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }